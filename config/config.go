@@ -1,6 +1,9 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+)
 
 func GetJWTSecret() []byte {
 	// 1. Tenta pegar a chave de uma variável de ambiente (Segurança para Produção)
@@ -13,3 +16,82 @@ func GetJWTSecret() []byte {
 	// Importante: Esta chave deve ser a mesma usada para GERAR o token no login
 	return []byte("oem@secret_key_super_segura#2026")
 }
+
+// Dados da empresa impressos nos comprovantes
+type CompanyInfo struct {
+	Name     string
+	Document string // CNPJ
+	Address  string
+	Phone    string
+}
+
+func GetCompanyInfo() CompanyInfo {
+	info := CompanyInfo{
+		Name:     os.Getenv("COMPANY_NAME"),
+		Document: os.Getenv("COMPANY_DOCUMENT"),
+		Address:  os.Getenv("COMPANY_ADDRESS"),
+		Phone:    os.Getenv("COMPANY_PHONE"),
+	}
+	if info.Name == "" {
+		info.Name = "OEM Congelados"
+	}
+	return info
+}
+
+// Pasta onde os relatórios agendados são gravados
+func GetReportsDir() string {
+	if dir := os.Getenv("REPORTS_DIR"); dir != "" {
+		return dir
+	}
+	return "./reports"
+}
+
+// Tamanho máximo do upload de backup (/restore e /jobs/restore), em MB
+func GetUploadLimit() int {
+	if mb, err := strconv.Atoi(os.Getenv("MAX_UPLOAD_MB")); err == nil && mb > 0 {
+		return mb << 20
+	}
+	return 512 << 20
+}
+
+// Senha padrão dos backups (cifragem e assinatura). Vazia: backups sem cifragem.
+func GetBackupPassphrase() string {
+	return os.Getenv("BACKUP_PASSPHRASE")
+}
+
+// Pasta dos backups automáticos
+func GetBackupDir() string {
+	if dir := os.Getenv("BACKUP_DIR"); dir != "" {
+		return dir
+	}
+	return "./backups"
+}
+
+// Expressão cron dos backups automáticos ("off" desativa). Padrão: todo dia às 02:00.
+func GetBackupSchedule() string {
+	if expr := os.Getenv("BACKUP_CRON"); expr != "" {
+		return expr
+	}
+	return "0 2 * * *"
+}
+
+// Quantos backups manter: um por dia, semana e mês mais recentes (avô-pai-filho)
+type BackupRetention struct {
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+func GetBackupRetention() BackupRetention {
+	keep := func(name string, def int) int {
+		if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n >= 0 {
+			return n
+		}
+		return def
+	}
+	return BackupRetention{
+		Daily:   keep("BACKUP_KEEP_DAILY", 7),
+		Weekly:  keep("BACKUP_KEEP_WEEKLY", 4),
+		Monthly: keep("BACKUP_KEEP_MONTHLY", 12),
+	}
+}
@@ -0,0 +1,611 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Categorias da viagem que geram lançamento contábil (ordem do arquivo)
+var accountingCategories = []struct {
+	Key   string
+	Label string
+	Value func(models.Trip) float64
+}{
+	{"value_withdraw", "Retirada de caixa", func(t models.Trip) float64 { return t.ValueWithdraw }},
+	{"value_received", "Valor recebido", func(t models.Trip) float64 { return t.ValueReceived }},
+	{"expense_fuel", "Combustível", func(t models.Trip) float64 { return t.ExpenseFuel }},
+	{"expense_daily", "Diárias", func(t models.Trip) float64 { return t.ExpenseDaily }},
+	{"expense_assistant", "Ajudantes", func(t models.Trip) float64 { return t.ExpenseAssistant }},
+	{"expense_toll", "Pedágio", func(t models.Trip) float64 { return t.ExpenseToll }},
+	{"expense_other", "Outras despesas", func(t models.Trip) float64 { return t.ExpenseOther }},
+}
+
+// Layout usado enquanto o admin não configurar outro
+var defaultJournalLayout = models.JournalLayout{
+	Format:           "csv",
+	Delimiter:        ";",
+	DateFormat:       "dd/mm/yyyy",
+	DecimalSeparator: ",",
+	Header:           true,
+	Columns: []models.JournalColumn{
+		{Field: "date", Title: "Data"},
+		{Field: "debit", Title: "Conta Débito"},
+		{Field: "credit", Title: "Conta Crédito"},
+		{Field: "amount", Title: "Valor"},
+		{Field: "cost_center", Title: "Centro de Custo"},
+		{Field: "history", Title: "Histórico"},
+		{Field: "trip_id", Title: "Viagem"},
+	},
+}
+
+var journalFields = map[string]bool{
+	"date": true, "debit": true, "credit": true, "amount": true, "cost_center": true,
+	"history": true, "trip_id": true, "category": true, "batch": true, "route": true, "driver": true,
+}
+
+// --- MAPEAMENTO DE CONTAS (Admin) ---
+func GetAccountMappings(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var mappings []models.AccountMapping
+	cursor, err := Db.Collection("account_mappings").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "category", Value: 1}}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar mapeamentos"})
+	}
+	cursor.All(ctx, &mappings)
+
+	if mappings == nil {
+		mappings = []models.AccountMapping{}
+	}
+	return c.JSON(mappings)
+}
+
+// Um mapeamento por categoria (upsert pela categoria)
+func SaveAccountMapping(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	var input models.AccountMapping
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Dados inválidos"})
+	}
+
+	valid := false
+	for _, cat := range accountingCategories {
+		if cat.Key == input.Category {
+			valid = true
+		}
+	}
+	if !valid {
+		return c.Status(400).JSON(fiber.Map{"error": "Categoria inválida"})
+	}
+	if input.DebitAccount == "" || input.CreditAccount == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Informe as contas de débito e crédito"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"debit_account":  input.DebitAccount,
+		"credit_account": input.CreditAccount,
+		"cost_center":    input.CostCenter,
+		"history":        input.History,
+	}}
+	_, err := Db.Collection("account_mappings").UpdateOne(ctx, bson.M{"category": input.Category}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar mapeamento"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Salvo com sucesso"})
+}
+
+func DeleteAccountMapping(c *fiber.Ctx) error {
+	return deleteAdminDocument(c, "account_mappings", "Mapeamento não encontrado.")
+}
+
+// --- LAYOUT DO ARQUIVO (Admin) ---
+func loadJournalLayout(ctx context.Context) (models.JournalLayout, error) {
+	var stored struct {
+		Layout models.JournalLayout `bson:"value"`
+	}
+	err := Db.Collection("settings").FindOne(ctx, bson.M{"_id": "journal_layout"}).Decode(&stored)
+	if err == mongo.ErrNoDocuments {
+		return defaultJournalLayout, nil
+	}
+	return stored.Layout, err
+}
+
+func GetJournalLayout(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	layout, err := loadJournalLayout(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar layout"})
+	}
+	return c.JSON(layout)
+}
+
+func SaveJournalLayout(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	var input models.JournalLayout
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Dados inválidos"})
+	}
+	if input.Format != "csv" && input.Format != "fixed" {
+		return c.Status(400).JSON(fiber.Map{"error": "Formato inválido (use csv ou fixed)"})
+	}
+	if len(input.Columns) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Informe as colunas do layout"})
+	}
+	for _, col := range input.Columns {
+		if !journalFields[col.Field] {
+			return c.Status(400).JSON(fiber.Map{"error": "Campo desconhecido no layout: " + col.Field})
+		}
+		if input.Format == "fixed" && col.Width <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Layout de largura fixa exige a largura de cada coluna"})
+		}
+	}
+	if input.Format == "csv" && len([]rune(input.Delimiter)) != 1 {
+		return c.Status(400).JSON(fiber.Map{"error": "Delimitador inválido"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := Db.Collection("settings").UpdateOne(ctx, bson.M{"_id": "journal_layout"}, bson.M{"$set": bson.M{"value": input}}, options.Update().SetUpsert(true))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar layout"})
+	}
+	return c.JSON(fiber.Map{"message": "Layout salvo com sucesso"})
+}
+
+// Converte dd/mm/yyyy (formato do usuário) para o layout do Go
+func goDateLayout(format string) string {
+	return strings.NewReplacer("yyyy", "2006", "yy", "06", "mm", "01", "dd", "02").Replace(strings.ToLower(format))
+}
+
+// Valor com o separador decimal do layout (vazio = centavos implícitos)
+func formatJournalAmount(value float64, separator string) string {
+	cents := int64(math.Round(value * 100))
+	if separator == "" {
+		return strconv.FormatInt(cents, 10)
+	}
+	return fmt.Sprintf("%d%s%02d", cents/100, separator, cents%100)
+}
+
+func fillHistory(template string, trip models.Trip, label string) string {
+	if template == "" {
+		template = label + " - viagem {route} {start_date}"
+	}
+	return strings.TrimSpace(strings.NewReplacer(
+		"{route}", trip.Route,
+		"{driver}", trip.Driver,
+		"{vehicle}", trip.Vehicle,
+		"{start_date}", formatDateBR(trip.StartDate),
+		"{trip_id}", trip.ID.Hex(),
+	).Replace(template))
+}
+
+// Valor de cada categoria da viagem, como vai para os lançamentos
+func accountingAmounts(trip models.Trip) map[string]float64 {
+	amounts := map[string]float64{}
+	for _, cat := range accountingCategories {
+		if amount := round2(cat.Value(trip)); amount > 0 {
+			amounts[cat.Key] = amount
+		}
+	}
+	return amounts
+}
+
+// Gera os lançamentos das viagens. Retorna as categorias sem mapeamento, se houver.
+// Viagens reabertas depois de exportadas geram só a diferença para o que já foi enviado
+// (estorno quando o valor diminuiu), a menos que full peça os lançamentos completos.
+func buildJournalLines(ctx context.Context, trips []models.Trip, full bool) ([]models.JournalLine, []string, error) {
+	var mappingList []models.AccountMapping
+	cursor, err := Db.Collection("account_mappings").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cursor.All(ctx, &mappingList); err != nil {
+		return nil, nil, err
+	}
+	mappings := map[string]models.AccountMapping{}
+	for _, m := range mappingList {
+		mappings[m.Category] = m
+	}
+
+	var routeList []models.Route
+	cursor, err = Db.Collection("routes").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cursor.All(ctx, &routeList); err != nil {
+		return nil, nil, err
+	}
+	routeCostCenters := map[string]string{}
+	for _, r := range routeList {
+		routeCostCenters[r.Name] = r.CostCenter
+	}
+
+	lines := []models.JournalLine{}
+	missing := map[string]bool{}
+
+	for _, trip := range trips {
+		date, err := parseDate(trip.EndDate)
+		if err != nil {
+			date, _ = parseDate(trip.StartDate)
+		}
+
+		correction := trip.AccountingCorrection && !full
+		amounts := accountingAmounts(trip)
+
+		for _, cat := range accountingCategories {
+			amount := amounts[cat.Key]
+			if correction {
+				amount = round2(amount - trip.AccountingExported[cat.Key])
+			}
+			if amount == 0 {
+				continue
+			}
+			mapping, ok := mappings[cat.Key]
+			if !ok {
+				missing[cat.Key] = true
+				continue
+			}
+
+			costCenter := mapping.CostCenter
+			if costCenter == "" {
+				costCenter = routeCostCenters[trip.Route]
+			}
+
+			line := models.JournalLine{
+				Date:          date,
+				DebitAccount:  mapping.DebitAccount,
+				CreditAccount: mapping.CreditAccount,
+				Amount:        amount,
+				CostCenter:    costCenter,
+				History:       fillHistory(mapping.History, trip, cat.Label),
+				Category:      cat.Key,
+				TripID:        trip.ID.Hex(),
+				Route:         trip.Route,
+				Driver:        trip.Driver,
+				Correction:    correction,
+			}
+			if amount < 0 {
+				// Estorno da parte já lançada: inverte débito e crédito
+				line.DebitAccount, line.CreditAccount = mapping.CreditAccount, mapping.DebitAccount
+				line.Amount = -amount
+				line.History = "Estorno - " + line.History
+			} else if correction {
+				line.History = "Ajuste - " + line.History
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	var missingList []string
+	for key := range missing {
+		missingList = append(missingList, key)
+	}
+	sort.Strings(missingList)
+	return lines, missingList, nil
+}
+
+// Monta o arquivo no layout configurado
+func renderJournal(lines []models.JournalLine, layout models.JournalLayout, batch string) ([]byte, error) {
+	dateLayout := goDateLayout(layout.DateFormat)
+
+	values := func(line models.JournalLine) []string {
+		row := make([]string, len(layout.Columns))
+		for i, col := range layout.Columns {
+			switch col.Field {
+			case "date":
+				row[i] = line.Date.Format(dateLayout)
+			case "debit":
+				row[i] = line.DebitAccount
+			case "credit":
+				row[i] = line.CreditAccount
+			case "amount":
+				row[i] = formatJournalAmount(line.Amount, layout.DecimalSeparator)
+			case "cost_center":
+				row[i] = line.CostCenter
+			case "history":
+				row[i] = line.History
+			case "trip_id":
+				row[i] = line.TripID
+			case "category":
+				row[i] = line.Category
+			case "batch":
+				row[i] = batch
+			case "route":
+				row[i] = line.Route
+			case "driver":
+				row[i] = line.Driver
+			}
+		}
+		return row
+	}
+
+	var buf bytes.Buffer
+
+	if layout.Format == "fixed" {
+		writeFixed := func(row []string) {
+			for i, col := range layout.Columns {
+				buf.WriteString(fixedWidth(row[i], col))
+			}
+			buf.WriteString("\r\n")
+		}
+		if layout.Header {
+			titles := make([]string, len(layout.Columns))
+			for i, col := range layout.Columns {
+				titles[i] = col.Title
+			}
+			writeFixed(titles)
+		}
+		for _, line := range lines {
+			writeFixed(values(line))
+		}
+		return buf.Bytes(), nil
+	}
+
+	writer := csv.NewWriter(&buf)
+	writer.Comma = []rune(layout.Delimiter)[0]
+	writer.UseCRLF = true
+	if layout.Header {
+		titles := make([]string, len(layout.Columns))
+		for i, col := range layout.Columns {
+			titles[i] = col.Title
+		}
+		writer.Write(titles)
+	}
+	for _, line := range lines {
+		writer.Write(values(line))
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// Ajusta o valor à largura da coluna (corta ou preenche)
+func fixedWidth(value string, col models.JournalColumn) string {
+	pad := col.Pad
+	if pad == "" {
+		pad = " "
+	}
+	runes := []rune(value)
+	if len(runes) > col.Width {
+		return string(runes[:col.Width])
+	}
+	fill := strings.Repeat(pad, col.Width-len(runes))
+	if col.Align == "right" {
+		return fill + value
+	}
+	return value + fill
+}
+
+// Viagens aprovadas do período ainda não exportadas (ou reabertas depois de exportadas)
+func journalTrips(ctx context.Context, c *fiber.Ctx) ([]models.Trip, tripQuery, error) {
+	query := tripQuery{From: c.Query("from"), To: c.Query("to"), Route: c.Query("route"), Status: "approved"}
+	query.defaultToCurrentMonth(time.Now())
+
+	filter, err := query.filter("", true)
+	if err != nil {
+		return nil, query, err
+	}
+	if !c.QueryBool("include_exported", false) {
+		filter["$or"] = bson.A{
+			bson.M{"accounting_batch": bson.M{"$exists": false}},
+			bson.M{"accounting_correction": true},
+		}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "start_date", Value: 1}})
+	var trips []models.Trip
+	cursor, err := Db.Collection("trips").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, query, err
+	}
+	err = cursor.All(ctx, &trips)
+	return trips, query, err
+}
+
+func sendJournal(c *fiber.Ctx, data []byte, layout models.JournalLayout, name string) error {
+	ext := "csv"
+	if layout.Format == "fixed" {
+		ext = "txt"
+	}
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", name, ext))
+	c.Set("Content-Type", "text/plain; charset=utf-8")
+	return c.Send(data)
+}
+
+// --- PRÉVIA DOS LANÇAMENTOS (Admin) ---
+// GET ?from=&to=&route=&include_exported=true&format=json. Não marca as viagens.
+func PreviewJournal(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	trips, query, err := journalTrips(ctx, c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Erro ao buscar viagens do período"})
+	}
+
+	lines, missing, err := buildJournalLines(ctx, trips, c.QueryBool("include_exported", false))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao gerar lançamentos"})
+	}
+
+	if c.Query("format") == "json" || len(missing) > 0 {
+		return c.JSON(fiber.Map{"from": query.From, "to": query.To, "trips": len(trips), "lines": lines, "missing_mappings": missing})
+	}
+
+	layout, err := loadJournalLayout(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar layout"})
+	}
+	data, err := renderJournal(lines, layout, "PREVIA")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao gerar arquivo"})
+	}
+	return sendJournal(c, data, layout, "lancamentos_previa_"+query.From)
+}
+
+// --- EXPORTAR LANÇAMENTOS E MARCAR VIAGENS (Admin) ---
+// POST ?from=&to=&route=. Gera um lote; as viagens não entram em exportações futuras.
+// Viagens reabertas e aprovadas de novo entram só com a diferença (ajuste ou estorno).
+func ExportJournal(c *fiber.Ctx) error {
+	username, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	trips, query, err := journalTrips(ctx, c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Erro ao buscar viagens do período"})
+	}
+	if len(trips) == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Nenhuma viagem aprovada pendente de exportação no período"})
+	}
+
+	replace := c.QueryBool("include_exported", false)
+	lines, missing, err := buildJournalLines(ctx, trips, replace)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao gerar lançamentos"})
+	}
+	if len(missing) > 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Existem categorias sem conta contábil mapeada", "missing_mappings": missing})
+	}
+
+	layout, err := loadJournalLayout(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar layout"})
+	}
+
+	batch := models.AccountingBatch{
+		ID:        primitive.NewObjectID(),
+		From:      query.From,
+		To:        query.To,
+		Lines:     len(lines),
+		CreatedBy: username,
+		CreatedAt: time.Now(),
+	}
+	var marks []exportMark
+	for _, trip := range trips {
+		marks = append(marks, exportMark{
+			TripID:     trip.ID,
+			Exported:   accountingAmounts(trip),
+			Correction: trip.AccountingCorrection && !replace,
+		})
+		batch.TripIDs = append(batch.TripIDs, trip.ID.Hex())
+	}
+	for _, line := range lines {
+		batch.Total += line.Amount
+	}
+	batch.Total = round2(batch.Total)
+
+	data, err := renderJournal(lines, layout, batch.ID.Hex())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao gerar arquivo"})
+	}
+
+	err = accountingExport.register(ctx, batch.ID, batch, marks, batch.CreatedAt, replace)
+	if errors.Is(err, errExportConflict) {
+		return c.Status(409).JSON(fiber.Map{"error": "Viagens exportadas por outro usuário ao mesmo tempo. Tente novamente."})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao registrar lote"})
+	}
+
+	return sendJournal(c, data, layout, "lancamentos_"+batch.ID.Hex())
+}
+
+// --- LOTES EXPORTADOS (Admin) ---
+func GetAccountingBatches(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var batches []models.AccountingBatch
+	cursor, err := Db.Collection("accounting_batches").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar lotes"})
+	}
+	cursor.All(ctx, &batches)
+
+	if batches == nil {
+		batches = []models.AccountingBatch{}
+	}
+	return c.JSON(batches)
+}
+
+// Cancela o lote: as viagens voltam a ficar pendentes de exportação
+func DeleteAccountingBatch(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+	}
+
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	found, err := accountingExport.release(ctx, objID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao liberar viagens do lote"})
+	}
+	if !found {
+		return c.Status(404).JSON(fiber.Map{"error": "Lote não encontrado."})
+	}
+
+	return c.JSON(fiber.Map{"message": "Lote cancelado. As viagens poderão ser exportadas novamente."})
+}
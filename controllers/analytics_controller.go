@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Campo da viagem usado em cada agrupamento da análise
+var profitGroupFields = map[string]func(models.Trip) string{
+	"route":   func(t models.Trip) string { return t.Route },
+	"vehicle": func(t models.Trip) string { return t.Vehicle },
+	"driver":  func(t models.Trip) string { return t.Driver },
+	"trip":    func(t models.Trip) string { return t.ID.Hex() },
+}
+
+type profitAccumulator struct {
+	models.ProfitMetrics
+}
+
+// Acumula uma viagem nos indicadores
+func (a *profitAccumulator) add(trip models.Trip) {
+	a.Trips++
+	a.Km += trip.KmDriven()
+	a.Revenue += trip.ValueReceived
+	a.Cost += trip.TotalExpenses()
+}
+
+// Calcula margem e indicadores por km
+func (a profitAccumulator) metrics() models.ProfitMetrics {
+	m := a.ProfitMetrics
+	m.Margin = m.Revenue - m.Cost
+	if m.Revenue != 0 {
+		m.MarginPct = m.Margin / m.Revenue
+	}
+	if m.Km > 0 {
+		m.CostPerKm = m.Cost / m.Km
+		m.RevenuePerKm = m.Revenue / m.Km
+		m.MarginPerKm = m.Margin / m.Km
+	}
+	return m
+}
+
+func tripMonth(trip models.Trip) string {
+	if len(trip.StartDate) >= 7 {
+		return trip.StartDate[:7]
+	}
+	return trip.StartDate
+}
+
+// Série mensal ordenada
+func profitMonths(months map[string]*profitAccumulator) []models.ProfitMonth {
+	result := []models.ProfitMonth{}
+	for month, acc := range months {
+		result = append(result, models.ProfitMonth{Month: month, ProfitMetrics: acc.metrics()})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Month < result[j].Month })
+	return result
+}
+
+// Período da comparação mês a mês: do primeiro dia do mês anterior ao de lastMonth
+// até o primeiro dia do mês seguinte (exclusivo)
+func comparisonPeriod(lastMonth time.Time) (string, string) {
+	first := time.Date(lastMonth.Year(), lastMonth.Month(), 1, 0, 0, 0, 0, lastMonth.Location())
+	return first.AddDate(0, -1, 0).Format(dateLayout), first.AddDate(0, 1, 0).Format(dateLayout)
+}
+
+// Acumula por mês as viagens da comparação, por grupo e no total.
+// Consulta própria: o mês anterior costuma ficar fora do período filtrado.
+func comparisonMonths(ctx context.Context, filter bson.M, keyOf func(models.Trip) string) (map[string]map[string]*profitAccumulator, map[string]*profitAccumulator, error) {
+	groups := map[string]map[string]*profitAccumulator{}
+	total := map[string]*profitAccumulator{}
+
+	cursor, err := Db.Collection("trips").Find(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var trip models.Trip
+		if err := cursor.Decode(&trip); err != nil {
+			return nil, nil, err
+		}
+		key := keyOf(trip)
+		if groups[key] == nil {
+			groups[key] = map[string]*profitAccumulator{}
+		}
+		month := tripMonth(trip)
+		for _, months := range []map[string]*profitAccumulator{groups[key], total} {
+			if months[month] == nil {
+				months[month] = &profitAccumulator{}
+			}
+			months[month].add(trip)
+		}
+	}
+	return groups, total, cursor.Err()
+}
+
+// Compara o último mês do período com o mês imediatamente anterior
+func compareLastMonths(months map[string]*profitAccumulator, lastMonth time.Time) *models.ProfitComparison {
+	first := time.Date(lastMonth.Year(), lastMonth.Month(), 1, 0, 0, 0, 0, lastMonth.Location())
+	current := first.Format("2006-01")
+	previous := first.AddDate(0, -1, 0).Format("2006-01")
+
+	var cur, prev models.ProfitMetrics
+	if acc, ok := months[current]; ok {
+		cur = acc.metrics()
+	}
+	if acc, ok := months[previous]; ok {
+		prev = acc.metrics()
+	}
+
+	comparison := &models.ProfitComparison{
+		Month:              current,
+		PreviousMonth:      previous,
+		MarginChange:       cur.Margin - prev.Margin,
+		RevenueChange:      cur.Revenue - prev.Revenue,
+		CostChange:         cur.Cost - prev.Cost,
+		CostPerKmChange:    cur.CostPerKm - prev.CostPerKm,
+		RevenuePerKmChange: cur.RevenuePerKm - prev.RevenuePerKm,
+	}
+	if prev.Margin != 0 {
+		pct := (cur.Margin - prev.Margin) / math.Abs(prev.Margin)
+		comparison.MarginChangePct = &pct
+	}
+	return comparison
+}
+
+// Monta a análise de rentabilidade a partir das viagens filtradas
+func buildProfitabilityReport(ctx context.Context, filter bson.M, groupBy string, lastMonth time.Time) (models.ProfitabilityReport, error) {
+	report := models.ProfitabilityReport{GroupBy: groupBy, Groups: []models.ProfitGroup{}}
+	keyOf := profitGroupFields[groupBy]
+
+	cursor, err := Db.Collection("trips").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "start_date", Value: 1}}))
+	if err != nil {
+		return report, err
+	}
+	defer cursor.Close(ctx)
+
+	type groupAcc struct {
+		total  profitAccumulator
+		months map[string]*profitAccumulator
+	}
+	groups := map[string]*groupAcc{}
+	var total profitAccumulator
+	totalMonths := map[string]*profitAccumulator{}
+
+	for cursor.Next(ctx) {
+		var trip models.Trip
+		if err := cursor.Decode(&trip); err != nil {
+			return report, err
+		}
+
+		key := keyOf(trip)
+		g, ok := groups[key]
+		if !ok {
+			g = &groupAcc{months: map[string]*profitAccumulator{}}
+			groups[key] = g
+		}
+
+		month := tripMonth(trip)
+		for _, months := range []map[string]*profitAccumulator{g.months, totalMonths} {
+			if months[month] == nil {
+				months[month] = &profitAccumulator{}
+			}
+			months[month].add(trip)
+		}
+		g.total.add(trip)
+		total.add(trip)
+	}
+	if err := cursor.Err(); err != nil {
+		return report, err
+	}
+
+	// Comparação mês a mês: mesmos filtros, mas com o período do mês anterior + último mês
+	compareFrom, compareTo := comparisonPeriod(lastMonth)
+	compareFilter := bson.M{}
+	for key, value := range filter {
+		compareFilter[key] = value
+	}
+	compareFilter["start_date"] = bson.M{"$gte": compareFrom, "$lt": compareTo}
+	compareGroups, compareTotal, err := comparisonMonths(ctx, compareFilter, keyOf)
+	if err != nil {
+		return report, err
+	}
+
+	for key, g := range groups {
+		report.Groups = append(report.Groups, models.ProfitGroup{
+			Key:            key,
+			ProfitMetrics:  g.total.metrics(),
+			Months:         profitMonths(g.months),
+			MonthOverMonth: compareLastMonths(compareGroups[key], lastMonth),
+		})
+	}
+
+	// Ranking pela margem (empate: maior receita)
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if report.Groups[i].Margin != report.Groups[j].Margin {
+			return report.Groups[i].Margin > report.Groups[j].Margin
+		}
+		return report.Groups[i].Revenue > report.Groups[j].Revenue
+	})
+	for i := range report.Groups {
+		report.Groups[i].Rank = i + 1
+	}
+
+	report.Totals = total.metrics()
+	report.Months = profitMonths(totalMonths)
+	report.MonthOverMonth = compareLastMonths(compareTotal, lastMonth)
+	return report, nil
+}
+
+// --- ANÁLISE DE CUSTO POR KM E RENTABILIDADE ---
+// ?group=route|vehicle|driver|trip (padrão: route), ?from=&to= (padrão: mês anterior + mês corrente)
+// e os demais filtros de viagem. Usuário comum vê apenas as próprias viagens.
+func GetProfitabilityAnalytics(c *fiber.Ctx) error {
+	username, isAdmin := getUserFromToken(c)
+	if username == "" && !isAdmin {
+		return c.Status(401).JSON(fiber.Map{"error": "Usuário não identificado"})
+	}
+
+	groupBy := c.Query("group", "route")
+	if _, ok := profitGroupFields[groupBy]; !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Agrupamento inválido (use route, vehicle, driver ou trip)"})
+	}
+
+	query := tripQueryFromCtx(c)
+	if query.From == "" && query.To == "" {
+		now := time.Now()
+		first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		query.From = first.AddDate(0, -1, 0).Format(dateLayout)
+		query.To = first.AddDate(0, 1, -1).Format(dateLayout)
+	}
+
+	filter, err := query.filter(username, isAdmin)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Período inválido"})
+	}
+
+	// Último mês do período (base da comparação mês a mês)
+	lastMonth := time.Now()
+	if query.To != "" {
+		if parsed, err := parseDate(query.To); err == nil {
+			lastMonth = parsed
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report, err := buildProfitabilityReport(ctx, filter, groupBy, lastMonth)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao gerar análise"})
+	}
+	report.From = query.From
+	report.To = query.To
+
+	return c.JSON(report)
+}
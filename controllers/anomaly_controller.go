@@ -0,0 +1,352 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Campos avaliados na detecção de anomalias
+var anomalyFields = []struct {
+	Key   string
+	Label string
+	Money bool
+	Value func(models.Trip) float64
+}{
+	{"km_driven", "Km rodados", false, func(t models.Trip) float64 { return t.KmDriven() }},
+	{"expense_fuel", "Combustível", true, func(t models.Trip) float64 { return t.ExpenseFuel }},
+	{"expense_daily", "Diárias", true, func(t models.Trip) float64 { return t.ExpenseDaily }},
+	{"expense_assistant", "Ajudantes", true, func(t models.Trip) float64 { return t.ExpenseAssistant }},
+	{"expense_toll", "Pedágio", true, func(t models.Trip) float64 { return t.ExpenseToll }},
+	{"expense_other", "Outras despesas", true, func(t models.Trip) float64 { return t.ExpenseOther }},
+}
+
+const (
+	anomalyMinSamples   = 5   // Abaixo disso a rota não tem histórico suficiente
+	anomalyHistoryLimit = 100 // Últimas viagens aprovadas da rota usadas como base
+	anomalyIQRFactor    = 1.5 // Cerca superior: Q3 + 1,5 x IQR
+	anomalyZThreshold   = 3.0 // Ou mais de 3 desvios padrão acima da média
+	anomalyMinRelative  = 0.2 // E no mínimo 20% acima da mediana (evita sinalizar variações pequenas)
+)
+
+// Quantil com interpolação linear (valores já ordenados)
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
+
+func computeFieldStats(field string, values []float64) models.FieldStats {
+	stats := models.FieldStats{Field: field, Samples: len(values)}
+	if len(values) == 0 {
+		return stats
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	stats.Mean = sum / float64(len(sorted))
+
+	variance := 0.0
+	for _, v := range sorted {
+		variance += (v - stats.Mean) * (v - stats.Mean)
+	}
+	if len(sorted) > 1 {
+		stats.StdDev = math.Sqrt(variance / float64(len(sorted)-1))
+	}
+
+	stats.Median = quantile(sorted, 0.5)
+	stats.Q1 = quantile(sorted, 0.25)
+	stats.Q3 = quantile(sorted, 0.75)
+	stats.UpperFence = stats.Q3 + anomalyIQRFactor*(stats.Q3-stats.Q1)
+	return stats
+}
+
+// Distribuição de cada campo no histórico (ignora a própria viagem)
+func routeFieldStats(history []models.Trip, skip primitive.ObjectID) map[string]models.FieldStats {
+	result := map[string]models.FieldStats{}
+	for _, f := range anomalyFields {
+		var values []float64
+		for _, t := range history {
+			if t.ID == skip {
+				continue
+			}
+			values = append(values, f.Value(t))
+		}
+		result[f.Key] = computeFieldStats(f.Key, values)
+	}
+	return result
+}
+
+// Compara a viagem com a distribuição da rota. Só valores acima do normal são sinalizados.
+func scoreTrip(trip models.Trip, stats map[string]models.FieldStats) []models.AnomalyFlag {
+	var flags []models.AnomalyFlag
+
+	for _, f := range anomalyFields {
+		s := stats[f.Key]
+		if s.Samples < anomalyMinSamples {
+			continue
+		}
+
+		value := f.Value(trip)
+		z := 0.0
+		if s.StdDev > 0 {
+			z = (value - s.Mean) / s.StdDev
+		}
+
+		outlier := value > s.UpperFence || z > anomalyZThreshold
+		if !outlier || value <= s.Median*(1+anomalyMinRelative) {
+			continue
+		}
+
+		format := func(v float64) string { return formatNumberBR(v, 0) + " km" }
+		if f.Money {
+			format = formatBRL
+		}
+
+		flags = append(flags, models.AnomalyFlag{
+			Field:      f.Key,
+			Value:      round2(value),
+			Median:     round2(s.Median),
+			UpperFence: round2(s.UpperFence),
+			ZScore:     round2(z),
+			Samples:    s.Samples,
+			Reason: fmt.Sprintf("%s de %s acima do normal da rota (mediana %s, limite %s, %d viagens)",
+				f.Label, format(value), format(s.Median), format(s.UpperFence), s.Samples),
+		})
+	}
+	return flags
+}
+
+// Últimas viagens aprovadas da rota (base estatística)
+func routeHistory(ctx context.Context, route string) ([]models.Trip, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "start_date", Value: -1}}).SetLimit(anomalyHistoryLimit)
+	var trips []models.Trip
+	cursor, err := Db.Collection("trips").Find(ctx, bson.M{"route": route, "approved": true}, opts)
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &trips)
+	return trips, err
+}
+
+// Grava as anomalias da viagem. A revisão só é descartada se os campos sinalizados mudarem.
+func saveTripAnomalies(ctx context.Context, trip models.Trip, flags []models.AnomalyFlag) error {
+	changed := len(flags) != len(trip.Anomalies)
+	for i := 0; !changed && i < len(flags); i++ {
+		changed = flags[i].Field != trip.Anomalies[i].Field
+	}
+
+	var update bson.M
+	switch {
+	case len(flags) == 0:
+		update = bson.M{"$unset": bson.M{"anomalies": "", "anomaly_review": ""}}
+	case changed:
+		update = bson.M{"$set": bson.M{"anomalies": flags}, "$unset": bson.M{"anomaly_review": ""}}
+	default:
+		update = bson.M{"$set": bson.M{"anomalies": flags}}
+	}
+
+	_, err := Db.Collection("trips").UpdateOne(ctx, bson.M{"_id": trip.ID}, update)
+	return err
+}
+
+// Reavalia uma viagem contra o histórico da rota (chamada no lançamento, edição e aprovação)
+func refreshTripAnomalies(ctx context.Context, tripID primitive.ObjectID) {
+	var trip models.Trip
+	if err := Db.Collection("trips").FindOne(ctx, bson.M{"_id": tripID}).Decode(&trip); err != nil {
+		log.Println("❌ Erro ao buscar viagem para detecção de anomalias:", err)
+		return
+	}
+
+	history, err := routeHistory(ctx, trip.Route)
+	if err != nil {
+		log.Println("❌ Erro ao buscar histórico da rota:", err)
+		return
+	}
+
+	if err := saveTripAnomalies(ctx, trip, scoreTrip(trip, routeFieldStats(history, trip.ID))); err != nil {
+		log.Println("❌ Erro ao gravar anomalias da viagem:", err)
+	}
+}
+
+// --- VIAGENS COM ANOMALIAS (Admin) ---
+// ?reviewed=false (padrão), true ou all, mais os filtros de viagem (?from=&to=&route=...)
+func GetAnomalies(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	filter, err := tripQueryFromCtx(c).filter("", true)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Período inválido"})
+	}
+	filter["anomalies.0"] = bson.M{"$exists": true}
+
+	switch c.Query("reviewed", "false") {
+	case "false":
+		filter["anomaly_review"] = bson.M{"$exists": false}
+	case "true":
+		filter["anomaly_review"] = bson.M{"$exists": true}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var trips []models.Trip
+	cursor, err := Db.Collection("trips").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "start_date", Value: -1}}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar anomalias"})
+	}
+	cursor.All(ctx, &trips)
+
+	result := []models.AnomalyTrip{}
+	for _, t := range trips {
+		result = append(result, models.AnomalyTrip{
+			TripID:    t.ID.Hex(),
+			Route:     t.Route,
+			Driver:    t.Driver,
+			Vehicle:   t.Vehicle,
+			UserID:    t.UserID,
+			StartDate: t.StartDate,
+			Approved:  t.Approved,
+			Flags:     t.Anomalies,
+			Review:    t.AnomalyReview,
+		})
+	}
+	return c.JSON(result)
+}
+
+// --- DISTRIBUIÇÃO HISTÓRICA DA ROTA (Admin) ---
+// ?route= (obrigatório)
+func GetRouteDistribution(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	route := c.Query("route")
+	if route == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Informe a rota"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	history, err := routeHistory(ctx, route)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar histórico da rota"})
+	}
+
+	stats := routeFieldStats(history, primitive.NilObjectID)
+	fields := []models.FieldStats{}
+	for _, f := range anomalyFields {
+		fields = append(fields, stats[f.Key])
+	}
+
+	return c.JSON(fiber.Map{"route": route, "min_samples": anomalyMinSamples, "fields": fields})
+}
+
+// --- MARCAR ANOMALIA COMO REVISADA (Admin) ---
+func ReviewAnomaly(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+	}
+
+	username, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	var input struct {
+		Notes string `json:"notes"`
+	}
+	c.BodyParser(&input)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	review := models.AnomalyReview{ReviewedBy: username, ReviewedAt: time.Now(), Notes: input.Notes}
+	filter := bson.M{"_id": objID, "anomalies.0": bson.M{"$exists": true}}
+	result, err := Db.Collection("trips").UpdateOne(ctx, filter, bson.M{"$set": bson.M{"anomaly_review": review}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao registrar revisão"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Viagem não encontrada ou sem anomalias."})
+	}
+
+	return c.JSON(fiber.Map{"message": "Anomalia revisada"})
+}
+
+// --- REAVALIAR VIAGENS DO PERÍODO (Admin) ---
+// Útil após importar histórico ou ajustar viagens antigas. Mesmos filtros de GetAllTrips.
+func RescanAnomalies(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	query := tripQueryFromCtx(c)
+	query.defaultToCurrentMonth(time.Now())
+	filter, err := query.filter("", true)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Período inválido"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	var trips []models.Trip
+	cursor, err := Db.Collection("trips").Find(ctx, filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar viagens"})
+	}
+	if err := cursor.All(ctx, &trips); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao ler viagens"})
+	}
+
+	// Histórico carregado uma vez por rota
+	histories := map[string][]models.Trip{}
+	flagged := 0
+	for _, trip := range trips {
+		history, ok := histories[trip.Route]
+		if !ok {
+			history, err = routeHistory(ctx, trip.Route)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar histórico da rota"})
+			}
+			histories[trip.Route] = history
+		}
+
+		flags := scoreTrip(trip, routeFieldStats(history, trip.ID))
+		if err := saveTripAnomalies(ctx, trip, flags); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Erro ao gravar anomalias"})
+		}
+		if len(flags) > 0 {
+			flagged++
+		}
+	}
+
+	return c.JSON(fiber.Map{"from": query.From, "to": query.To, "scanned": len(trips), "flagged": flagged})
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Completa os ajudantes com os dados do cadastro e recalcula ExpenseAssistant.
+// A diária nunca vem do corpo: ajudante do cadastro usa a diária já gravada na viagem
+// (previous, valor histórico) ou a atual do cadastro. Ajudante fora do cadastro só
+// pode ter diária informada por administrador; para os demais vale a já gravada.
+func applyAssistants(ctx context.Context, trip *models.Trip, previous []models.TripAssistant, isAdmin bool) error {
+	if len(trip.Assistants) == 0 {
+		return nil
+	}
+
+	stored := map[primitive.ObjectID]float64{}
+	storedByName := map[string]float64{}
+	for _, a := range previous {
+		if a.AssistantID.IsZero() {
+			storedByName[a.Name] = a.DailyRate
+		} else {
+			stored[a.AssistantID] = a.DailyRate
+		}
+	}
+
+	total := 0.0
+	for i := range trip.Assistants {
+		a := &trip.Assistants[i]
+		if a.Days <= 0 {
+			return errors.New("Informe os dias trabalhados de cada ajudante")
+		}
+
+		if !a.AssistantID.IsZero() {
+			var assistant models.Assistant
+			if err := Db.Collection("assistants").FindOne(ctx, bson.M{"_id": a.AssistantID}).Decode(&assistant); err != nil {
+				return errors.New("Ajudante não encontrado no cadastro")
+			}
+			a.Name = assistant.Name
+			if rate, ok := stored[a.AssistantID]; ok {
+				a.DailyRate = rate
+			} else {
+				a.DailyRate = assistant.DailyRate
+			}
+		} else if !isAdmin {
+			rate, ok := storedByName[a.Name]
+			if !ok {
+				return errors.New("Ajudante fora do cadastro: apenas administradores podem informar a diária")
+			}
+			a.DailyRate = rate
+		}
+		if a.Name == "" {
+			return errors.New("Ajudante sem nome")
+		}
+		if a.DailyRate < 0 {
+			return errors.New("Diária do ajudante inválida")
+		}
+
+		a.Amount = math.Round(a.Days*a.DailyRate*100) / 100
+		total += a.Amount
+	}
+
+	trip.ExpenseAssistant = math.Round(total*100) / 100
+	return nil
+}
+
+// Linha do relatório de pagamento de ajudantes
+type assistantPayment struct {
+	AssistantID string   `json:"assistant_id"`
+	Name        string   `json:"name"`
+	Document    string   `json:"document"`
+	Trips       int      `json:"trips"`
+	Days        float64  `json:"days"`
+	Amount      float64  `json:"amount"`
+	TripIDs     []string `json:"trip_ids"`
+}
+
+// --- RELATÓRIO DE PAGAMENTO DE AJUDANTES (Admin) ---
+// ?from=&to= filtra pela data de saída da viagem; ?approved=true só viagens fechadas
+func GetAssistantPaymentReport(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem ver este relatório."})
+	}
+
+	from, to, err := periodFromQuery(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Período inválido"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"assistants.0": bson.M{"$exists": true}}
+	applyPeriodFilter(filter, from, to)
+	if c.QueryBool("approved", false) {
+		filter["approved"] = true
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "start_date", Value: 1}})
+	cursor, err := Db.Collection("trips").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar viagens"})
+	}
+	var trips []models.Trip
+	cursor.All(ctx, &trips)
+
+	// Documento vem do cadastro atual
+	var catalog []models.Assistant
+	catalogCursor, err := Db.Collection("assistants").Find(ctx, bson.M{})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar ajudantes"})
+	}
+	catalogCursor.All(ctx, &catalog)
+	documents := map[primitive.ObjectID]string{}
+	for _, a := range catalog {
+		documents[a.ID] = a.Document
+	}
+
+	payments := map[string]*assistantPayment{}
+	for _, trip := range trips {
+		for _, a := range trip.Assistants {
+			key := a.Name
+			if !a.AssistantID.IsZero() {
+				key = a.AssistantID.Hex()
+			}
+
+			p, ok := payments[key]
+			if !ok {
+				p = &assistantPayment{Name: a.Name, Document: documents[a.AssistantID], TripIDs: []string{}}
+				if !a.AssistantID.IsZero() {
+					p.AssistantID = a.AssistantID.Hex()
+				}
+				payments[key] = p
+			}
+			p.Trips++
+			p.Days += a.Days
+			p.Amount += a.Amount
+			p.TripIDs = append(p.TripIDs, trip.ID.Hex())
+		}
+	}
+
+	result := []assistantPayment{}
+	total := 0.0
+	for _, p := range payments {
+		p.Amount = math.Round(p.Amount*100) / 100
+		total += p.Amount
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return c.JSON(fiber.Map{
+		"from":        c.Query("from"),
+		"to":          c.Query("to"),
+		"assistants":  result,
+		"total":       math.Round(total*100) / 100,
+		"trips_count": len(trips),
+	})
+}
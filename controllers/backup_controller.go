@@ -1,60 +1,182 @@
 package controllers
 
 import (
+	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"strings"
 	"time"
 
+	"backend/config"
+
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// Estrutura do arquivo de backup
-type BackupData struct {
-	Timestamp time.Time           `json:"timestamp"`
-	Data      map[string][]bson.M `json:"data"` // Mapa: Nome da Coleção -> Lista de Documentos
+// Documentos inseridos por vez na restauração (limita a memória usada)
+const restoreBatchSize = 500
+
+// Tamanho máximo do lote em bytes (documentos grandes, como pedaços do GridFS)
+const restoreBatchBytes = 16 << 20
+
+// Prazo do backup proporcional ao volume: 1 min + 1 s a cada 2.000 documentos (máx. 1 h)
+func backupTimeout(docs int64) time.Duration {
+	timeout := time.Minute + time.Duration(docs/2000)*time.Second
+	if timeout > time.Hour {
+		timeout = time.Hour
+	}
+	return timeout
 }
 
-// Lista das coleções que queremos salvar
-var collectionsToBackup = []string{"users", "trips", "drivers", "vehicles", "routes"}
+// Prazo da restauração proporcional ao arquivo: 1 min + 30 s por MB compactado (máx. 1 h)
+func restoreTimeout(size int64) time.Duration {
+	timeout := time.Minute + time.Duration(size/(1<<20))*30*time.Second
+	if timeout > time.Hour {
+		timeout = time.Hour
+	}
+	return timeout
+}
 
-// --- GERAR BACKUP (Download) ---
-func DownloadBackup(c *fiber.Ctx) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// Senha do backup: cabeçalho X-Backup-Passphrase ou, sem ele, BACKUP_PASSPHRASE
+func backupPassphrase(c *fiber.Ctx) string {
+	if passphrase := c.Get("X-Backup-Passphrase"); passphrase != "" {
+		return passphrase
+	}
+	return config.GetBackupPassphrase()
+}
 
-	fullBackup := BackupData{
-		Timestamp: time.Now(),
-		Data:      make(map[string][]bson.M),
+// Extensão do arquivo conforme a cifragem
+func backupExtension(passphrase string) string {
+	if passphrase != "" {
+		return ".ndjson.gz.enc"
 	}
+	return ".ndjson.gz"
+}
+
+// Andamento de backup e restauração (usado pelas tarefas em segundo plano, pode ser nil)
+type progressFunc func(phase, collection string, done int)
 
-	// 1. Itera sobre cada coleção e pega todos os dados
-	for _, colName := range collectionsToBackup {
-		cursor, err := Db.Collection(colName).Find(ctx, bson.M{})
+// Documentos por coleção do backup (estimativa rápida, para prazo e andamento)
+func backupEstimate(ctx context.Context) (map[string]int, int64, error) {
+	names, err := backupCollections(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	counts := map[string]int{}
+	var total int64
+	for _, colName := range names {
+		n, err := Db.Collection(colName).EstimatedDocumentCount(ctx)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Erro ao ler coleção " + colName})
+			return nil, 0, fmt.Errorf("erro ao ler coleção %s: %w", colName, err)
 		}
+		counts[colName] = int(n)
+		total += n
+	}
+	return counts, total, nil
+}
 
-		var docs []bson.M
-		if err = cursor.All(ctx, &docs); err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Erro ao decodificar " + colName})
+// Grava o backup de todas as coleções (com opções e índices) lendo direto dos cursores.
+// Com senha o arquivo sai cifrado e assinado.
+func writeBackup(ctx context.Context, w io.Writer, timestamp time.Time, passphrase string, progress progressFunc) error {
+	names, err := backupCollections(ctx)
+	if err != nil {
+		return err
+	}
+	bw, err := newBackupWriter(w, timestamp, names, passphrase)
+	if err != nil {
+		return err
+	}
+
+	for _, colName := range names {
+		meta, err := collectionMetadata(ctx, colName)
+		if err != nil {
+			return fmt.Errorf("erro ao ler índices de %s: %w", colName, err)
+		}
+		if err := bw.BeginCollection(colName, meta); err != nil {
+			return err
+		}
+
+		opts := options.Find().SetBatchSize(restoreBatchSize).SetSort(bson.D{{Key: "_id", Value: 1}})
+		cursor, err := Db.Collection(colName).Find(ctx, bson.M{}, opts)
+		if err != nil {
+			return fmt.Errorf("erro ao ler coleção %s: %w", colName, err)
+		}
+		done := 0
+		for cursor.Next(ctx) {
+			if err := bw.WriteDoc(cursor.Current); err != nil {
+				cursor.Close(ctx)
+				return err
+			}
+			done++
+			if progress != nil {
+				progress("backup", colName, done)
+			}
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return fmt.Errorf("erro ao ler coleção %s: %w", colName, err)
 		}
+	}
 
-		fullBackup.Data[colName] = docs
+	return bw.Close()
+}
+
+// --- GERAR BACKUP (Download) ---
+// Gzip de NDJSON gerado em streaming (ver backup_format.go)
+func DownloadBackup(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem gerar backup."})
 	}
 
+	// 1. Estima o volume para definir o prazo
+	countCtx, countCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	_, total, err := backupEstimate(countCtx)
+	countCancel()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao ler coleções do backup"})
+	}
+
+	// O contexto vive até o fim do streaming, que acontece depois do handler retornar
+	ctx, cancel := context.WithTimeout(context.Background(), backupTimeout(total))
+	timestamp := time.Now()
+	passphrase := backupPassphrase(c)
+
 	// 2. Define o nome do arquivo com data
-	filename := fmt.Sprintf("backup_oem_%s.json", time.Now().Format("2006-01-02_15-04"))
+	filename := fmt.Sprintf("backup_oem_%s%s", timestamp.Format("2006-01-02_15-04"), backupExtension(passphrase))
 	c.Set("Content-Disposition", "attachment; filename="+filename)
-	c.Set("Content-Type", "application/json")
+	c.Set("Content-Type", "application/gzip")
+	if passphrase != "" {
+		c.Set("Content-Type", "application/octet-stream")
+	}
 
-	return c.JSON(fullBackup)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+
+		// Em caso de erro o arquivo fica sem rodapé e a restauração o recusa
+		if err := writeBackup(ctx, w, timestamp, passphrase, nil); err != nil {
+			log.Println("❌ Erro ao gerar backup:", err)
+		}
+		w.Flush()
+	})
+	return nil
 }
 
 // --- RESTAURAR BACKUP (Upload) ---
+// Aceita o formato atual (.ndjson.gz) e os arquivos .json das versões anteriores.
+// Com ?dry_run=true apenas informa o que seria adicionado, removido e alterado.
+// Pode restaurar só algumas coleções, viagens de um período ou um documento (ver restoreOptionsFromQuery).
 func RestoreBackup(c *fiber.Ctx) error {
+	username, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem restaurar backup."})
+	}
+
 	// 1. Ler o arquivo enviado
 	file, err := c.FormFile("backup_file")
 	if err != nil {
@@ -67,67 +189,88 @@ func RestoreBackup(c *fiber.Ctx) error {
 	}
 	defer f.Close()
 
-	// 2. Decodificar JSON
-	var backup BackupData
-	if err := json.NewDecoder(f).Decode(&backup); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Arquivo inválido ou corrompido"})
+	return restoreAndRespond(c, f, file.Size, username)
+}
+
+// Restauração (ou simulação) a partir de um arquivo já aberto, com as opções da query
+func restoreAndRespond(c *fiber.Ctx, f io.Reader, size int64, username string) error {
+	opts, err := restoreOptionsFromQuery(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
+	opts.User = username
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout(size))
 	defer cancel()
 
-	// 3. Processar cada coleção
-	for colName, docs := range backup.Data {
-		// Pular coleções desconhecidas por segurança
-		valid := false
-		for _, v := range collectionsToBackup {
-			if v == colName {
-				valid = true
-				break
-			}
+	// Simulação: só compara com o banco, sem gravar nada
+	if c.QueryBool("dry_run", false) {
+		return restoreDryRun(c, ctx, f, opts)
+	}
+
+	// Restaurar em coleções de preparo e trocar pelas reais só se tudo estiver válido
+	summary, err := restoreFromReader(ctx, f, opts)
+	if err != nil {
+		if errors.Is(err, errRestoreRunning) {
+			return c.Status(409).JSON(fiber.Map{"error": "Existe uma restauração em andamento."})
 		}
-		if !valid {
-			continue
+		if summary.Mode == restoreMerge && summary.Inserted != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Restauração interrompida, parte dos documentos já foi gravada (pode ser repetida): " + err.Error(), "inserted": summary.Inserted, "updated": summary.Updated})
 		}
+		return c.Status(400).JSON(fiber.Map{"error": "Restauração cancelada, nenhum dado foi alterado: " + err.Error()})
+	}
 
-		collection := Db.Collection(colName)
-
-		// A: Limpar coleção atual (Restore completo)
-		collection.Drop(ctx)
+	message := "Sistema restaurado com sucesso! Os dados anteriores podem ser recuperados em /api/restore/rollback."
+	if summary.Mode == restoreMerge {
+		message = "Documentos restaurados com sucesso. Os demais dados não foram alterados."
+	}
+	return c.JSON(fiber.Map{
+		"message":        message,
+		"mode":           summary.Mode,
+		"timestamp":      summary.Timestamp,
+		"format_version": summary.FormatVersion,
+		"schema_version": summary.SchemaVersion,
+		"migrations":     summary.Migrations,
+		"collections":    summary.Collections,
+		"indexes":        summary.Indexes,
+		"inserted":       summary.Inserted,
+		"updated":        summary.Updated,
+		"skipped":        summary.Skipped,
+	})
+}
 
-		if len(docs) == 0 {
-			continue
-		}
+// Opções da restauração pela query:
+// mode=replace|merge, collections=trips,drivers, from/to (viagens), id (um documento).
+// Filtro por período ou id sempre usa merge. Arquivos sem assinatura exigem allow_unsigned=true.
+func restoreOptionsFromQuery(c *fiber.Ctx) (restoreOptions, error) {
+	opts := restoreOptions{Mode: c.Query("mode", restoreReplace), DocID: strings.TrimSpace(c.Query("id"))}
+	if opts.Mode != restoreReplace && opts.Mode != restoreMerge {
+		return opts, errors.New("Modo inválido (use replace ou merge)")
+	}
 
-		// B: Converter Tipos (JSON transformou ObjectID e Date em String)
-		var interfaces []interface{}
-		for _, doc := range docs {
-			// Corrige _id
-			if idStr, ok := doc["_id"].(string); ok {
-				if oid, err := primitive.ObjectIDFromHex(idStr); err == nil {
-					doc["_id"] = oid
-				}
+	if list := c.Query("collections"); list != "" {
+		for _, name := range strings.Split(list, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
 			}
-
-			// Corrige campos de Data conhecidos
-			dateFields := []string{"start_date", "created_at", "CreatedAt", "timestamp"}
-			for _, field := range dateFields {
-				if val, ok := doc[field].(string); ok {
-					// Tenta parsear datas ISO do JSON
-					if parsed, err := time.Parse(time.RFC3339, val); err == nil {
-						doc[field] = parsed
-					}
-				}
+			if !isBackupCollection(name) {
+				return opts, errors.New("Coleção desconhecida: " + name)
 			}
-
-			interfaces = append(interfaces, doc)
+			opts.Collections = append(opts.Collections, name)
 		}
+	}
 
-		// C: Inserir dados restaurados
-		if _, err := collection.InsertMany(ctx, interfaces); err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Erro ao inserir dados em " + colName})
-		}
+	opts.Security = backupSecurity{Passphrase: backupPassphrase(c), AllowUnsigned: c.QueryBool("allow_unsigned", false)}
+
+	from, to, err := periodFromQuery(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return opts, errors.New("Período inválido")
 	}
+	opts.From, opts.To = from, to
 
-	return c.JSON(fiber.Map{"message": "Sistema restaurado com sucesso!", "timestamp": backup.Timestamp})
+	if opts.merge() {
+		opts.Mode = restoreMerge
+	}
+	return opts, nil
 }
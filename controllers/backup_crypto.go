@@ -0,0 +1,271 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Cifragem dos backups: AES-256-GCM em blocos, para o arquivo não precisar caber
+// em memória. A chave vem da senha via scrypt; sal e parâmetros ficam no cabeçalho,
+// que entra como dado autenticado de cada bloco. O nonce de cada bloco é
+// prefixo aleatório + contador + marca de último bloco, então blocos trocados,
+// removidos ou um arquivo cortado não passam na verificação.
+//
+// Arquivo: encryptedMagic, cabeçalho JSON + "\n", e blocos [tamanho uint32][dados cifrados].
+
+var encryptedMagic = []byte("OEMBACKUP-ENC\n")
+
+const (
+	encChunkSize   = 64 * 1024
+	encPrefixSize  = 7
+	scryptN        = 1 << 15
+	scryptR        = 8
+	scryptP        = 1
+	maxScryptN     = 1 << 20 // Limite ao ler, para um cabeçalho forjado não travar o servidor
+	backupKeyBytes = 32
+)
+
+// Segurança do arquivo: com senha o backup é cifrado e o manifesto assinado
+type backupSecurity struct {
+	Passphrase    string
+	AllowUnsigned bool // Aceita arquivos sem assinatura (sem senha ou de versões antigas)
+}
+
+type encryptionHeader struct {
+	Cipher      string `json:"cipher"`
+	KDF         string `json:"kdf"`
+	N           int    `json:"n"`
+	R           int    `json:"r"`
+	P           int    `json:"p"`
+	Salt        []byte `json:"salt"`
+	NoncePrefix []byte `json:"nonce_prefix"`
+	ChunkSize   int    `json:"chunk_size"`
+}
+
+// Chaves separadas para cifrar e para assinar o manifesto
+type backupKeys struct {
+	enc []byte
+	mac []byte
+}
+
+func deriveBackupKeys(passphrase string, h encryptionHeader) (backupKeys, error) {
+	master, err := scrypt.Key([]byte(passphrase), h.Salt, h.N, h.R, h.P, backupKeyBytes)
+	if err != nil {
+		return backupKeys{}, err
+	}
+	enc, err := hkdf.Key(sha256.New, master, h.Salt, "oem-backup encryption", backupKeyBytes)
+	if err != nil {
+		return backupKeys{}, err
+	}
+	mac, err := hkdf.Key(sha256.New, master, h.Salt, "oem-backup manifest", backupKeyBytes)
+	if err != nil {
+		return backupKeys{}, err
+	}
+	return backupKeys{enc: enc, mac: mac}, nil
+}
+
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 0, 12)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// Cifra o que for escrito. O bloco cheio só é gravado quando chega mais dado,
+// para o último bloco (gravado no Close) ser sempre o marcado.
+type encryptingWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	aad     []byte
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	size    int
+}
+
+func newEncryptingWriter(w io.Writer, passphrase string) (*encryptingWriter, backupKeys, error) {
+	h := encryptionHeader{Cipher: "aes-256-gcm", KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, ChunkSize: encChunkSize}
+	h.Salt = make([]byte, 16)
+	h.NoncePrefix = make([]byte, encPrefixSize)
+	if _, err := rand.Read(h.Salt); err != nil {
+		return nil, backupKeys{}, err
+	}
+	if _, err := rand.Read(h.NoncePrefix); err != nil {
+		return nil, backupKeys{}, err
+	}
+
+	keys, err := deriveBackupKeys(passphrase, h)
+	if err != nil {
+		return nil, keys, err
+	}
+	aead, err := newBackupAEAD(keys.enc)
+	if err != nil {
+		return nil, keys, err
+	}
+
+	headerLine, err := json.Marshal(h)
+	if err != nil {
+		return nil, keys, err
+	}
+	if _, err := w.Write(encryptedMagic); err != nil {
+		return nil, keys, err
+	}
+	if _, err := w.Write(append(headerLine, '\n')); err != nil {
+		return nil, keys, err
+	}
+
+	return &encryptingWriter{w: w, aead: aead, aad: headerLine, prefix: h.NoncePrefix, size: h.ChunkSize, buf: make([]byte, 0, h.ChunkSize)}, keys, nil
+}
+
+func newBackupAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (e *encryptingWriter) writeChunk(last bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.counter, last), e.buf, e.aad)
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+	if _, err := e.w.Write(length[:]); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+	e.counter++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+func (e *encryptingWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if len(e.buf) == e.size {
+			if err := e.writeChunk(false); err != nil {
+				return n - len(p), err
+			}
+		}
+		take := min(e.size-len(e.buf), len(p))
+		e.buf = append(e.buf, p[:take]...)
+		p = p[take:]
+	}
+	return n, nil
+}
+
+func (e *encryptingWriter) Close() error {
+	return e.writeChunk(true)
+}
+
+// Decifra bloco a bloco. Erro se faltar o último bloco ou sobrar dado depois dele.
+type decryptingReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	aad     []byte
+	prefix  []byte
+	counter uint32
+	maxLen  int
+	plain   []byte
+	done    bool
+}
+
+func isEncryptedBackup(br *bufio.Reader) bool {
+	magic, err := br.Peek(len(encryptedMagic))
+	return err == nil && bytes.Equal(magic, encryptedMagic)
+}
+
+func newDecryptingReader(br *bufio.Reader, passphrase string) (*decryptingReader, backupKeys, error) {
+	if passphrase == "" {
+		return nil, backupKeys{}, errors.New("backup cifrado: informe a senha")
+	}
+	br.Discard(len(encryptedMagic))
+	headerLine, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, backupKeys{}, errors.New("cabeçalho de cifragem incompleto")
+	}
+	headerLine = bytes.TrimSuffix(headerLine, []byte("\n"))
+
+	var h encryptionHeader
+	if err := json.Unmarshal(headerLine, &h); err != nil {
+		return nil, backupKeys{}, errors.New("cabeçalho de cifragem inválido")
+	}
+	if h.Cipher != "aes-256-gcm" || h.KDF != "scrypt" || len(h.NoncePrefix) != encPrefixSize ||
+		h.N <= 1 || h.N > maxScryptN || h.R <= 0 || h.P <= 0 || h.R*h.P > 64 || h.ChunkSize <= 0 || h.ChunkSize > 16<<20 {
+		return nil, backupKeys{}, fmt.Errorf("parâmetros de cifragem não suportados (%s/%s)", h.Cipher, h.KDF)
+	}
+
+	keys, err := deriveBackupKeys(passphrase, h)
+	if err != nil {
+		return nil, keys, err
+	}
+	aead, err := newBackupAEAD(keys.enc)
+	if err != nil {
+		return nil, keys, err
+	}
+	return &decryptingReader{r: br, aead: aead, aad: headerLine, prefix: h.NoncePrefix, maxLen: h.ChunkSize + aead.Overhead()}, keys, nil
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptingReader) nextChunk() error {
+	var length [4]byte
+	if _, err := io.ReadFull(d.r, length[:]); err != nil {
+		return errors.New("arquivo cifrado incompleto")
+	}
+	size := int(binary.BigEndian.Uint32(length[:]))
+	if size > d.maxLen {
+		return errors.New("bloco cifrado inválido")
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return errors.New("arquivo cifrado incompleto")
+	}
+
+	// Tenta como bloco intermediário e, se não for, como o último
+	plain, err := d.aead.Open(nil, chunkNonce(d.prefix, d.counter, false), sealed, d.aad)
+	if err != nil {
+		plain, err = d.aead.Open(nil, chunkNonce(d.prefix, d.counter, true), sealed, d.aad)
+		if err != nil {
+			if d.counter == 0 {
+				return errors.New("senha incorreta ou arquivo adulterado")
+			}
+			return errors.New("arquivo cifrado adulterado")
+		}
+		if _, err := d.r.Peek(1); err != io.EOF {
+			return errors.New("dados após o fim do backup cifrado")
+		}
+		d.done = true
+	}
+	d.counter++
+	d.plain = plain
+	return nil
+}
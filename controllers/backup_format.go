@@ -0,0 +1,566 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Versão do formato do arquivo:
+//
+//	1: JSON simples com "data" (ObjectID e datas viravam string)
+//	2: JSON único com Extended JSON canônico em "collections"
+//	3: NDJSON compactado com gzip, gravado em streaming
+//	4: como o 3, com SHA-256 por coleção no rodapé e, com senha, cifrado e assinado
+//	5: marcador da coleção com opções e índices; inclui arquivos GridFS (formato atual)
+//
+// A partir do formato 3 cada linha é um JSON: o cabeçalho, um marcador
+// {"$collection": nome, "options": {...}, "indexes": [...]} antes dos documentos
+// de cada coleção, os documentos em Extended JSON canônico
+// e por fim o rodapé {"$end": true, "counts": {...}, "checksums": {...}, "signature": "..."},
+// que permite detectar arquivo truncado ou alterado. A assinatura é um HMAC-SHA256 do
+// cabeçalho e do manifesto (contagens e checksums) com chave derivada da senha.
+const backupFormatVersion = 5
+
+// Lista das coleções que queremos salvar. jobs e restore_snapshots ficam de fora:
+// descrevem o próprio servidor, não os dados.
+var collectionsToBackup = []string{
+	"users", "trips", "drivers", "vehicles", "routes", "assistants",
+	"maintenance_plans", "maintenance_records", "settlements", "per_diem_rules", "holidays",
+	"budgets", "account_mappings", "accounting_batches", "payroll_batches",
+	"report_schedules", "report_runs", "settings",
+}
+
+// Anexos guardados no GridFS (<bucket>.files e <bucket>.chunks), encontrados no backup
+var gridFSCollection = regexp.MustCompile(`^[A-Za-z0-9_-]+\.(files|chunks)$`)
+
+// Opções de criação (validator, collation, capped...) e índices da coleção, exceto o _id
+type collectionMeta struct {
+	Options bson.Raw
+	Indexes []bson.Raw
+}
+
+type collectionMarkerLine struct {
+	Name    string            `json:"$collection"`
+	Options json.RawMessage   `json:"options,omitempty"`
+	Indexes []json.RawMessage `json:"indexes,omitempty"`
+}
+
+type backupHeader struct {
+	FormatVersion int       `json:"format_version"`
+	SchemaVersion int       `json:"schema_version,omitempty"` // Ver schema_migrations.go
+	Timestamp     time.Time `json:"timestamp"`
+	Collections   []string  `json:"collections"`
+}
+
+type backupTrailer struct {
+	End       bool              `json:"$end"`
+	Counts    map[string]int    `json:"counts"`
+	Checksums map[string]string `json:"checksums,omitempty"` // SHA-256 das linhas de cada coleção
+	Signature string            `json:"signature,omitempty"` // Só em arquivos cifrados
+}
+
+var errUnsignedBackup = errors.New("backup sem assinatura (sem senha ou de versão antiga); envie allow_unsigned=true para aceitar")
+
+// HMAC do cabeçalho e do manifesto
+func manifestSignature(key, headerLine []byte, trailer backupTrailer) string {
+	manifest, _ := json.Marshal(struct {
+		Counts    map[string]int    `json:"counts"`
+		Checksums map[string]string `json:"checksums"`
+	}{trailer.Counts, trailer.Checksums})
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(headerLine)
+	mac.Write([]byte{'\n'})
+	mac.Write(manifest)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+var (
+	collectionMarker = []byte(`{"$collection":`)
+	endMarker        = []byte(`{"$end":`)
+)
+
+// Grava o backup documento a documento, sem montar o arquivo em memória.
+// Com senha, o gzip passa por encryptingWriter (ver backup_crypto.go).
+type backupWriter struct {
+	enc     *encryptingWriter
+	gz      *gzip.Writer
+	bw      *bufio.Writer
+	current string
+	counts  map[string]int
+	hashes  map[string]hash.Hash
+	header  []byte
+	macKey  []byte
+}
+
+func newBackupWriter(w io.Writer, timestamp time.Time, collections []string, passphrase string) (*backupWriter, error) {
+	b := &backupWriter{counts: map[string]int{}, hashes: map[string]hash.Hash{}}
+	if passphrase != "" {
+		enc, keys, err := newEncryptingWriter(w, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		b.enc, b.macKey = enc, keys.mac
+		w = enc
+	}
+	b.gz = gzip.NewWriter(w)
+	b.bw = bufio.NewWriterSize(b.gz, 64*1024)
+
+	header, err := json.Marshal(backupHeader{FormatVersion: backupFormatVersion, SchemaVersion: schemaVersion, Timestamp: timestamp.UTC(), Collections: collections})
+	if err != nil {
+		return nil, err
+	}
+	b.header = header
+	b.bw.Write(header)
+	if err := b.bw.WriteByte('\n'); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *backupWriter) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b.bw.Write(data)
+	return b.bw.WriteByte('\n')
+}
+
+// Inicia uma coleção. Coleções vazias também são marcadas (a restauração as limpa).
+// O marcador entra no checksum da coleção, protegendo também opções e índices.
+func (b *backupWriter) BeginCollection(name string, meta collectionMeta) error {
+	marker := collectionMarkerLine{Name: name}
+	if len(meta.Options) > 0 {
+		data, err := bson.MarshalExtJSON(meta.Options, true, false)
+		if err != nil {
+			return fmt.Errorf("%s: opções: %w", name, err)
+		}
+		marker.Options = data
+	}
+	for _, index := range meta.Indexes {
+		data, err := bson.MarshalExtJSON(index, true, false)
+		if err != nil {
+			return fmt.Errorf("%s: índice: %w", name, err)
+		}
+		marker.Indexes = append(marker.Indexes, data)
+	}
+	line, err := json.Marshal(marker)
+	if err != nil {
+		return err
+	}
+
+	b.current = name
+	b.counts[name] = 0
+	b.hashes[name] = sha256.New()
+	b.hashes[name].Write(line)
+	b.hashes[name].Write([]byte{'\n'})
+	b.bw.Write(line)
+	return b.bw.WriteByte('\n')
+}
+
+func (b *backupWriter) WriteDoc(doc bson.Raw) error {
+	if b.current == "" {
+		return errors.New("documento fora de uma coleção")
+	}
+	data, err := bson.MarshalExtJSON(doc, true, false)
+	if err != nil {
+		return fmt.Errorf("%s: documento %d: %w", b.current, b.counts[b.current]+1, err)
+	}
+	b.bw.Write(data)
+	if err := b.bw.WriteByte('\n'); err != nil {
+		return err
+	}
+	h := b.hashes[b.current]
+	h.Write(data)
+	h.Write([]byte{'\n'})
+	b.counts[b.current]++
+	return nil
+}
+
+// Grava o rodapé com o manifesto e fecha o gzip (e a cifragem)
+func (b *backupWriter) Close() error {
+	trailer := backupTrailer{End: true, Counts: b.counts, Checksums: map[string]string{}}
+	for name, h := range b.hashes {
+		trailer.Checksums[name] = hex.EncodeToString(h.Sum(nil))
+	}
+	if b.macKey != nil {
+		trailer.Signature = manifestSignature(b.macKey, b.header, trailer)
+	}
+
+	if err := b.writeJSON(trailer); err != nil {
+		return err
+	}
+	if err := b.bw.Flush(); err != nil {
+		return err
+	}
+	if err := b.gz.Close(); err != nil {
+		return err
+	}
+	if b.enc != nil {
+		return b.enc.Close()
+	}
+	return nil
+}
+
+// Item lido do backup: início de coleção (Doc == nil, com Meta) ou documento
+type backupEntry struct {
+	Collection string
+	Doc        bson.Raw
+	Meta       collectionMeta
+}
+
+// Lê o backup em streaming. Arquivos nos formatos 1 e 2 são lidos inteiros (eram pequenos).
+// Documentos de esquema antigo saem já migrados para o atual.
+type backupReader struct {
+	Header     backupHeader
+	Signed     bool              // Arquivo cifrado com assinatura (conferida no rodapé)
+	Migrations []schemaMigration // Aplicadas aos documentos lidos
+
+	br      *bufio.Reader
+	current string
+	counts  map[string]int
+	hashes  map[string]hash.Hash
+	header  []byte
+	macKey  []byte
+	done    bool
+
+	legacy []backupEntry
+}
+
+// Arquivos sem senha (ou de versões antigas) só são aceitos com sec.AllowUnsigned
+func newBackupReader(r io.Reader, sec backupSecurity) (*backupReader, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	var macKey []byte
+	if isEncryptedBackup(br) {
+		dr, keys, err := newDecryptingReader(br, sec.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		macKey = keys.mac
+		br = bufio.NewReaderSize(dr, 64*1024)
+	} else if !sec.AllowUnsigned {
+		return nil, errUnsignedBackup
+	}
+
+	// gzip (formato 3 em diante) ou JSON puro (formatos antigos)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReaderSize(gz, 64*1024)
+	}
+
+	first, err := br.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	b := &backupReader{br: br, counts: map[string]int{}, hashes: map[string]hash.Hash{}, macKey: macKey, header: bytes.TrimRight(first, "\r\n")}
+	if err := json.Unmarshal(first, &b.Header); err == nil && b.Header.FormatVersion >= 3 {
+		if b.Header.FormatVersion > backupFormatVersion {
+			return nil, fmt.Errorf("backup gerado por uma versão mais nova do sistema (formato %d)", b.Header.FormatVersion)
+		}
+		if macKey != nil && b.Header.FormatVersion < 4 {
+			return nil, errors.New("backup cifrado com formato inválido")
+		}
+		return b, b.setSchema()
+	}
+	if macKey != nil {
+		return nil, errors.New("backup cifrado com formato inválido")
+	}
+
+	// Formatos 1 e 2: a primeira linha é só o começo do JSON
+	snapshot, err := decodeLegacyBackup(io.MultiReader(bytes.NewReader(first), br))
+	if err != nil {
+		return nil, err
+	}
+	b.Header = backupHeader{FormatVersion: snapshot.Version, Timestamp: snapshot.Timestamp}
+	if err := b.setSchema(); err != nil {
+		return nil, err
+	}
+	for _, col := range snapshot.Collections {
+		b.Header.Collections = append(b.Header.Collections, col.Name)
+		b.legacy = append(b.legacy, backupEntry{Collection: col.Name})
+		for i, doc := range col.Docs {
+			migrated, err := migrateDocument(b.Migrations, col.Name, doc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: documento %d: %w", col.Name, i+1, err)
+			}
+			b.legacy = append(b.legacy, backupEntry{Collection: col.Name, Doc: migrated})
+		}
+	}
+	b.done = true
+	return b, nil
+}
+
+// Recusa esquema mais novo e separa as migrações a aplicar
+func (b *backupReader) setSchema() error {
+	if b.Header.SchemaVersion == 0 {
+		b.Header.SchemaVersion = 1
+	}
+	if b.Header.SchemaVersion > schemaVersion {
+		return fmt.Errorf("backup de um esquema mais novo que o deste sistema (%d > %d); atualize o sistema antes de restaurar", b.Header.SchemaVersion, schemaVersion)
+	}
+	b.Migrations = pendingMigrations(b.Header.SchemaVersion)
+	return nil
+}
+
+// Próximo item do backup. Retorna io.EOF no fim; arquivo sem rodapé ou com
+// contagem diferente da registrada é considerado corrompido.
+func (b *backupReader) Next() (backupEntry, error) {
+	if b.legacy != nil || b.done {
+		if len(b.legacy) == 0 {
+			return backupEntry{}, io.EOF
+		}
+		entry := b.legacy[0]
+		b.legacy = b.legacy[1:]
+		return entry, nil
+	}
+
+	line, err := b.br.ReadBytes('\n')
+	if err == io.EOF && len(line) == 0 {
+		return backupEntry{}, errors.New("arquivo incompleto (sem o rodapé do backup)")
+	}
+	if err != nil && err != io.EOF {
+		return backupEntry{}, err
+	}
+	line = bytes.TrimRight(line, "\r\n")
+
+	switch {
+	case bytes.HasPrefix(line, collectionMarker):
+		var marker collectionMarkerLine
+		if err := json.Unmarshal(line, &marker); err != nil || marker.Name == "" {
+			return backupEntry{}, errors.New("marcador de coleção inválido")
+		}
+		var meta collectionMeta
+		if len(marker.Options) > 0 {
+			if err := bson.UnmarshalExtJSON(marker.Options, true, &meta.Options); err != nil {
+				return backupEntry{}, fmt.Errorf("%s: opções inválidas: %w", marker.Name, err)
+			}
+		}
+		for _, data := range marker.Indexes {
+			var index bson.Raw
+			if err := bson.UnmarshalExtJSON(data, true, &index); err != nil {
+				return backupEntry{}, fmt.Errorf("%s: índice inválido: %w", marker.Name, err)
+			}
+			meta.Indexes = append(meta.Indexes, index)
+		}
+
+		b.current = marker.Name
+		b.counts[marker.Name] = 0
+		b.hashes[marker.Name] = sha256.New()
+		if b.Header.FormatVersion >= 5 {
+			b.hashes[marker.Name].Write(line)
+			b.hashes[marker.Name].Write([]byte{'\n'})
+		}
+		return backupEntry{Collection: marker.Name, Meta: meta}, nil
+
+	case bytes.HasPrefix(line, endMarker):
+		var trailer backupTrailer
+		if err := json.Unmarshal(line, &trailer); err != nil {
+			return backupEntry{}, errors.New("rodapé do backup inválido")
+		}
+		if err := b.verifyTrailer(trailer); err != nil {
+			return backupEntry{}, err
+		}
+		b.done = true
+		return backupEntry{}, io.EOF
+	}
+
+	if b.current == "" {
+		return backupEntry{}, errors.New("documento fora de uma coleção")
+	}
+	var doc bson.Raw
+	if err := bson.UnmarshalExtJSON(line, true, &doc); err != nil {
+		return backupEntry{}, fmt.Errorf("%s: documento %d: %w", b.current, b.counts[b.current]+1, err)
+	}
+	h := b.hashes[b.current]
+	h.Write(line)
+	h.Write([]byte{'\n'})
+	b.counts[b.current]++
+
+	doc, err = migrateDocument(b.Migrations, b.current, doc)
+	if err != nil {
+		return backupEntry{}, fmt.Errorf("%s: documento %d: %w", b.current, b.counts[b.current], err)
+	}
+	return backupEntry{Collection: b.current, Doc: doc}, nil
+}
+
+// Confere contagens, checksums (formato 4) e a assinatura do manifesto
+func (b *backupReader) verifyTrailer(trailer backupTrailer) error {
+	if len(trailer.Counts) != len(b.counts) {
+		return errors.New("coleções do arquivo não conferem com o rodapé")
+	}
+	for name, count := range trailer.Counts {
+		if b.counts[name] != count {
+			return fmt.Errorf("%s: %d documentos lidos, %d esperados", name, b.counts[name], count)
+		}
+	}
+
+	if b.Header.FormatVersion >= 4 {
+		if len(trailer.Checksums) != len(b.counts) {
+			return errors.New("manifesto sem checksum de todas as coleções")
+		}
+		for name, h := range b.hashes {
+			if trailer.Checksums[name] != hex.EncodeToString(h.Sum(nil)) {
+				return fmt.Errorf("%s: checksum SHA-256 não confere", name)
+			}
+		}
+	}
+
+	if b.macKey != nil {
+		expected := manifestSignature(b.macKey, b.header, trailer)
+		if !hmac.Equal([]byte(trailer.Signature), []byte(expected)) {
+			return errors.New("assinatura do backup inválida")
+		}
+		b.Signed = true
+	}
+	return nil
+}
+
+// --- FORMATOS ANTIGOS (1 e 2) ---
+
+// Documentos de uma coleção exatamente como estão no banco
+type backupCollection struct {
+	Name string
+	Meta collectionMeta
+	Docs []bson.Raw
+}
+
+type backupSnapshot struct {
+	Version     int
+	Timestamp   time.Time
+	Collections []backupCollection
+}
+
+func decodeLegacyBackup(r io.Reader) (backupSnapshot, error) {
+	var file struct {
+		FormatVersion int                          `json:"format_version"`
+		Timestamp     time.Time                    `json:"timestamp"`
+		Collections   map[string][]json.RawMessage `json:"collections"`
+		Data          map[string][]bson.M          `json:"data"` // Formato 1
+	}
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return backupSnapshot{}, err
+	}
+
+	snapshot := backupSnapshot{Version: file.FormatVersion, Timestamp: file.Timestamp}
+
+	switch file.FormatVersion {
+	case 0:
+		snapshot.Version = 1
+		for _, name := range backupCollectionOrder(file.Data) {
+			docs, err := legacyDocuments(file.Data[name])
+			if err != nil {
+				return snapshot, fmt.Errorf("%s: %w", name, err)
+			}
+			snapshot.Collections = append(snapshot.Collections, backupCollection{Name: name, Docs: docs})
+		}
+
+	case 2:
+		for _, name := range backupCollectionOrder(file.Collections) {
+			col := backupCollection{Name: name, Docs: make([]bson.Raw, 0, len(file.Collections[name]))}
+			for i, data := range file.Collections[name] {
+				var doc bson.Raw
+				if err := bson.UnmarshalExtJSON(data, true, &doc); err != nil {
+					return snapshot, fmt.Errorf("%s: documento %d: %w", name, i+1, err)
+				}
+				col.Docs = append(col.Docs, doc)
+			}
+			snapshot.Collections = append(snapshot.Collections, col)
+		}
+
+	default:
+		return snapshot, fmt.Errorf("formato de backup desconhecido (%d)", file.FormatVersion)
+	}
+
+	if snapshot.Collections == nil {
+		return snapshot, errors.New("backup sem coleções")
+	}
+	return snapshot, nil
+}
+
+// Coleções conhecidas primeiro (na ordem do backup), depois as demais em ordem alfabética
+func backupCollectionOrder[T any](collections map[string]T) []string {
+	var names []string
+	for _, name := range collectionsToBackup {
+		if _, ok := collections[name]; ok {
+			names = append(names, name)
+		}
+	}
+	var others []string
+	for name := range collections {
+		if !isBackupCollection(name) {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	return append(names, others...)
+}
+
+func isBackupCollection(name string) bool {
+	for _, v := range collectionsToBackup {
+		if v == name {
+			return true
+		}
+	}
+	return isGridFSCollection(name)
+}
+
+// Cópias de trabalho da restauração (restore_staging_fs.files...) não são anexos
+func isGridFSCollection(name string) bool {
+	for _, prefix := range []string{stagingPrefix, rollbackPrefix, swapPrefix} {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+	return gridFSCollection.MatchString(name)
+}
+
+// Formato 1: o JSON transformou ObjectID e Date em string, então os tipos
+// são recuperados pelos campos conhecidos (melhor esforço)
+func legacyDocuments(docs []bson.M) ([]bson.Raw, error) {
+	dateFields := []string{"start_date", "created_at", "CreatedAt", "timestamp"}
+
+	result := make([]bson.Raw, 0, len(docs))
+	for _, doc := range docs {
+		if idStr, ok := doc["_id"].(string); ok {
+			if oid, err := primitive.ObjectIDFromHex(idStr); err == nil {
+				doc["_id"] = oid
+			}
+		}
+		for _, field := range dateFields {
+			if val, ok := doc[field].(string); ok {
+				if parsed, err := time.Parse(time.RFC3339, val); err == nil {
+					doc[field] = parsed
+				}
+			}
+		}
+
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, raw)
+	}
+	return result, nil
+}
@@ -0,0 +1,380 @@
+package controllers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func mustRaw(t *testing.T, doc bson.D) bson.Raw {
+	t.Helper()
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// Documentos com os tipos que o JSON simples perdia
+func sampleSnapshot(t *testing.T) backupSnapshot {
+	price, _ := primitive.ParseDecimal128("6.179")
+	approvedAt := time.Date(2026, 3, 10, 14, 30, 15, 123000000, time.UTC)
+
+	trip := mustRaw(t, bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "user_id", Value: "maria"},
+		{Key: "approved", Value: true},
+		{Key: "approved_at", Value: approvedAt},
+		{Key: "created_at", Value: primitive.NewDateTimeFromTime(approvedAt.Add(-48 * time.Hour))},
+		{Key: "start_date", Value: "2026-03-08"},
+		{Key: "km_start", Value: 1200.0},
+		{Key: "km_end", Value: int32(1650)},
+		{Key: "legacy_counter", Value: int64(1) << 40},
+		{Key: "price", Value: price},
+		{Key: "refuels", Value: bson.A{
+			bson.D{{Key: "liters", Value: 80.5}, {Key: "full_tank", Value: true}},
+		}},
+		{Key: "assistants", Value: bson.A{
+			bson.D{{Key: "assistant_id", Value: primitive.NewObjectID()}, {Key: "days", Value: 2.0}},
+		}},
+		{Key: "anomaly_review", Value: bson.D{{Key: "reviewed_at", Value: approvedAt}}},
+		{Key: "notes", Value: nil},
+		{Key: "attachment", Value: primitive.Binary{Subtype: 0x00, Data: []byte{0xde, 0xad, 0xbe, 0xef}}},
+		{Key: "html", Value: "<b>R$ 10 & \"aspas\"</b> ç"},
+		{Key: "negative_zero", Value: math.Copysign(0, -1)},
+	})
+	user := mustRaw(t, bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "username", Value: "admin"},
+		{Key: "role", Value: "admin"},
+	})
+	usersMeta := collectionMeta{
+		Options: mustRaw(t, bson.D{{Key: "collation", Value: bson.D{{Key: "locale", Value: "pt"}, {Key: "strength", Value: int32(2)}}}}),
+		Indexes: []bson.Raw{mustRaw(t, bson.D{
+			{Key: "v", Value: int32(2)},
+			{Key: "key", Value: bson.D{{Key: "username", Value: int32(1)}}},
+			{Key: "name", Value: "username_1"},
+			{Key: "unique", Value: true},
+		})},
+	}
+
+	return backupSnapshot{
+		Version:   backupFormatVersion,
+		Timestamp: time.Date(2026, 3, 11, 2, 0, 0, 0, time.UTC),
+		Collections: []backupCollection{
+			{Name: "users", Meta: usersMeta, Docs: []bson.Raw{user}},
+			{Name: "trips", Docs: []bson.Raw{trip}},
+			{Name: "drivers", Docs: []bson.Raw{}},
+		},
+	}
+}
+
+// Arquivos de teste sem senha
+var unsigned = backupSecurity{AllowUnsigned: true}
+
+// Grava o snapshot com o mesmo writer usado no download
+func encodeSnapshot(t *testing.T, snapshot backupSnapshot, passphrase string) []byte {
+	t.Helper()
+	var names []string
+	for _, col := range snapshot.Collections {
+		names = append(names, col.Name)
+	}
+
+	var buf bytes.Buffer
+	w, err := newBackupWriter(&buf, snapshot.Timestamp, names, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, col := range snapshot.Collections {
+		if err := w.BeginCollection(col.Name, col.Meta); err != nil {
+			t.Fatal(err)
+		}
+		for _, doc := range col.Docs {
+			if err := w.WriteDoc(doc); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Lê o arquivo com o mesmo reader usado na restauração
+func decodeSnapshot(r io.Reader, sec backupSecurity) (backupSnapshot, error) {
+	reader, err := newBackupReader(r, sec)
+	if err != nil {
+		return backupSnapshot{}, err
+	}
+	snapshot := backupSnapshot{Version: reader.Header.FormatVersion, Timestamp: reader.Header.Timestamp}
+	for {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			return snapshot, nil
+		}
+		if err != nil {
+			return snapshot, err
+		}
+		if entry.Doc == nil {
+			snapshot.Collections = append(snapshot.Collections, backupCollection{Name: entry.Collection, Meta: entry.Meta, Docs: []bson.Raw{}})
+			continue
+		}
+		last := &snapshot.Collections[len(snapshot.Collections)-1]
+		last.Docs = append(last.Docs, entry.Doc)
+	}
+}
+
+// backup -> restore -> backup deve produzir exatamente os mesmos bytes
+func TestBackupRoundTrip(t *testing.T) {
+	original := sampleSnapshot(t)
+	first := encodeSnapshot(t, original, "")
+
+	restored, err := decodeSnapshot(bytes.NewReader(first), unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Version != backupFormatVersion {
+		t.Fatalf("versão = %d, esperado %d", restored.Version, backupFormatVersion)
+	}
+	if !restored.Timestamp.Equal(original.Timestamp) {
+		t.Fatalf("timestamp = %v, esperado %v", restored.Timestamp, original.Timestamp)
+	}
+	if len(restored.Collections) != len(original.Collections) {
+		t.Fatalf("%d coleções, esperado %d", len(restored.Collections), len(original.Collections))
+	}
+	for i, col := range original.Collections {
+		got := restored.Collections[i]
+		if got.Name != col.Name || len(got.Docs) != len(col.Docs) {
+			t.Fatalf("coleção %d = %s (%d docs), esperado %s (%d docs)", i, got.Name, len(got.Docs), col.Name, len(col.Docs))
+		}
+		if !bytes.Equal(got.Meta.Options, col.Meta.Options) || len(got.Meta.Indexes) != len(col.Meta.Indexes) {
+			t.Fatalf("%s: opções ou índices diferem: %+v", col.Name, got.Meta)
+		}
+		for j := range col.Meta.Indexes {
+			if !bytes.Equal(got.Meta.Indexes[j], col.Meta.Indexes[j]) {
+				t.Errorf("%s: índice %d difere:\n got  %s\n want %s", col.Name, j, got.Meta.Indexes[j], col.Meta.Indexes[j])
+			}
+		}
+		for j := range col.Docs {
+			if !bytes.Equal(got.Docs[j], col.Docs[j]) {
+				t.Errorf("%s[%d] difere:\n got  %s\n want %s", col.Name, j, got.Docs[j], col.Docs[j])
+			}
+		}
+	}
+
+	second := encodeSnapshot(t, restored, "")
+	if !bytes.Equal(first, second) {
+		t.Fatal("backup após restauração difere do original")
+	}
+}
+
+// Linhas do NDJSON de um backup sem senha
+func backupLines(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	var plain bytes.Buffer
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(&plain, gz)
+	return bytes.SplitAfter(plain.Bytes(), []byte("\n"))
+}
+
+// Arquivo cortado no meio (download interrompido) não pode ser restaurado
+func TestTruncatedBackupIsRejected(t *testing.T) {
+	lines := backupLines(t, encodeSnapshot(t, sampleSnapshot(t), ""))
+
+	// Sem o rodapé
+	truncated := bytes.Join(lines[:len(lines)-2], nil)
+	if _, err := decodeSnapshot(bytes.NewReader(truncated), unsigned); err == nil {
+		t.Fatal("esperado erro para backup sem rodapé")
+	}
+}
+
+// Documento alterado depois do backup não passa no checksum
+func TestChecksumMismatchIsRejected(t *testing.T) {
+	lines := backupLines(t, encodeSnapshot(t, sampleSnapshot(t), ""))
+
+	for i, line := range lines {
+		if bytes.Contains(line, []byte(`"maria"`)) {
+			lines[i] = bytes.Replace(line, []byte(`"maria"`), []byte(`"mario"`), 1)
+		}
+	}
+	_, err := decodeSnapshot(bytes.NewReader(bytes.Join(lines, nil)), unsigned)
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("esperado erro de checksum, veio %v", err)
+	}
+}
+
+func TestEncryptedBackup(t *testing.T) {
+	original := sampleSnapshot(t)
+	data := encodeSnapshot(t, original, "senha forte")
+
+	if bytes.Contains(data, []byte("maria")) {
+		t.Fatal("backup cifrado contém texto puro")
+	}
+
+	restored, err := decodeSnapshot(bytes.NewReader(data), backupSecurity{Passphrase: "senha forte"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored.Collections[1].Docs[0], original.Collections[1].Docs[0]) {
+		t.Fatal("documento decifrado difere do original")
+	}
+
+	if _, err := decodeSnapshot(bytes.NewReader(data), backupSecurity{Passphrase: "outra"}); err == nil {
+		t.Error("esperado erro com senha errada")
+	}
+	if _, err := decodeSnapshot(bytes.NewReader(data), backupSecurity{}); err == nil {
+		t.Error("esperado erro sem senha")
+	}
+
+	tampered := bytes.Clone(data)
+	tampered[len(tampered)-20] ^= 0x01
+	if _, err := decodeSnapshot(bytes.NewReader(tampered), backupSecurity{Passphrase: "senha forte"}); err == nil {
+		t.Error("esperado erro para arquivo adulterado")
+	}
+
+	if _, err := decodeSnapshot(bytes.NewReader(data[:len(data)-30]), backupSecurity{Passphrase: "senha forte"}); err == nil {
+		t.Error("esperado erro para arquivo cifrado incompleto")
+	}
+}
+
+// Sem assinatura só com aceite explícito
+func TestUnsignedBackupRequiresOptIn(t *testing.T) {
+	data := encodeSnapshot(t, sampleSnapshot(t), "")
+	if _, err := decodeSnapshot(bytes.NewReader(data), backupSecurity{}); err != errUnsignedBackup {
+		t.Fatalf("erro = %v, esperado %v", err, errUnsignedBackup)
+	}
+}
+
+func TestDecodeLegacyBackup(t *testing.T) {
+	id := primitive.NewObjectID()
+	legacy := `{"timestamp":"2025-01-02T03:04:05Z","data":{"trips":[{"_id":"` + id.Hex() + `","created_at":"2025-01-01T10:00:00Z","route":"Sul"}],"users":[]}}`
+
+	snapshot, err := decodeSnapshot(strings.NewReader(legacy), unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Version != 1 {
+		t.Fatalf("versão = %d, esperado 1", snapshot.Version)
+	}
+	if len(snapshot.Collections) != 2 || snapshot.Collections[0].Name != "users" || snapshot.Collections[1].Name != "trips" {
+		t.Fatalf("coleções inesperadas: %+v", snapshot.Collections)
+	}
+
+	doc := snapshot.Collections[1].Docs[0]
+	if got, ok := doc.Lookup("_id").ObjectIDOK(); !ok || got != id {
+		t.Errorf("_id = %v, esperado ObjectID %s", doc.Lookup("_id"), id.Hex())
+	}
+	if _, ok := doc.Lookup("created_at").DateTimeOK(); !ok {
+		t.Errorf("created_at = %v, esperado data", doc.Lookup("created_at"))
+	}
+}
+
+func TestDecodeBackupRejectsNewerFormat(t *testing.T) {
+	_, err := decodeSnapshot(strings.NewReader(`{"format_version":99,"collections":["users"]}`+"\n"), unsigned)
+	if err == nil {
+		t.Fatal("esperado erro para formato mais novo")
+	}
+}
+
+// Backup de esquema antigo é convertido para o atual na leitura
+func TestLegacyBackupIsMigrated(t *testing.T) {
+	savedVersion, savedMigrations := schemaVersion, schemaMigrations
+	defer func() { schemaVersion, schemaMigrations = savedVersion, savedMigrations }()
+
+	schemaVersion = 2
+	schemaMigrations = []schemaMigration{{
+		To:          2,
+		Description: "Renomeia isadmin dos usuários",
+		Collections: map[string]func(bson.D) bson.D{
+			"users": func(doc bson.D) bson.D {
+				if value, ok := docValue(doc, "isadmin"); ok {
+					doc = append(docWithout(doc, "isadmin"), bson.E{Key: "is_admin", Value: value})
+				}
+				return doc
+			},
+		},
+	}}
+
+	legacy := `{"format_version":2,"timestamp":"2025-01-02T03:04:05Z","collections":{` +
+		`"users":[{"_id":{"$oid":"` + primitive.NewObjectID().Hex() + `"},"username":"admin","isadmin":true}],` +
+		`"trips":[{"_id":{"$oid":"` + primitive.NewObjectID().Hex() + `"},"route":"Sul","km_start":{"$numberDouble":"100"}}]}}`
+
+	reader, err := newBackupReader(strings.NewReader(legacy), unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := migrationDescriptions(reader.Migrations); len(got) != 1 || got[0] != "v2: Renomeia isadmin dos usuários" {
+		t.Fatalf("migrações = %v", got)
+	}
+
+	snapshot, err := decodeSnapshot(strings.NewReader(legacy), unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := snapshot.Collections[0].Docs[0]
+	if admin, ok := user.Lookup("is_admin").BooleanOK(); !ok || !admin {
+		t.Errorf("is_admin = %v, esperado true", user.Lookup("is_admin"))
+	}
+	if _, err := user.LookupErr("isadmin"); err == nil {
+		t.Error("campo antigo isadmin não foi removido")
+	}
+
+	// Coleção sem migração continua igual
+	trip := snapshot.Collections[1].Docs[0]
+	if km, ok := trip.Lookup("km_start").DoubleOK(); !ok || km != 100 {
+		t.Errorf("km_start = %v, esperado 100", trip.Lookup("km_start"))
+	}
+	if _, err := trip.LookupErr("expense_fuel"); err == nil {
+		t.Error("trips não tem migração e ganhou expense_fuel")
+	}
+}
+
+// Sem migrações pendentes os documentos saem com os mesmos bytes
+func TestCurrentSchemaIsNotMigrated(t *testing.T) {
+	legacy := `{"format_version":2,"timestamp":"2025-01-02T03:04:05Z","collections":{` +
+		`"users":[{"_id":{"$oid":"` + primitive.NewObjectID().Hex() + `"},"username":"admin","isadmin":true}]}}`
+
+	snapshot, err := decodeSnapshot(strings.NewReader(legacy), unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := snapshot.Collections[0].Docs[0]
+	if admin, ok := user.Lookup("isadmin").BooleanOK(); !ok || !admin {
+		t.Errorf("isadmin = %v, esperado true (sem migração)", user.Lookup("isadmin"))
+	}
+}
+
+func TestDecodeBackupRejectsNewerSchema(t *testing.T) {
+	header := fmt.Sprintf(`{"format_version":%d,"schema_version":%d,"collections":["users"]}`, backupFormatVersion, schemaVersion+1)
+	if _, err := decodeSnapshot(strings.NewReader(header+"\n"), unsigned); err == nil {
+		t.Fatal("esperado erro para esquema mais novo")
+	}
+}
+
+// Opções e índices entram no checksum da coleção
+func TestIndexTamperingIsRejected(t *testing.T) {
+	lines := backupLines(t, encodeSnapshot(t, sampleSnapshot(t), ""))
+
+	for i, line := range lines {
+		if bytes.HasPrefix(line, collectionMarker) {
+			lines[i] = bytes.Replace(line, []byte(`"unique":true`), []byte(`"unique":false`), 1)
+		}
+	}
+	_, err := decodeSnapshot(bytes.NewReader(bytes.Join(lines, nil)), unsigned)
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("esperado erro de checksum, veio %v", err)
+	}
+}
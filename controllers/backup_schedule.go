@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/cron"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Backups automáticos gravados em BACKUP_DIR. A pasta é a fonte da verdade:
+// o nome do arquivo traz a data e não há registro no banco (que pode ser restaurado).
+const storedBackupLayout = "2006-01-02_15-04-05"
+
+var storedBackupName = regexp.MustCompile(`^backup_oem_(\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2})\.ndjson\.gz(\.enc)?$`)
+
+// Evita dois backups gravando ao mesmo tempo (agendado e manual)
+var storedBackupMu sync.Mutex
+
+type storedBackup struct {
+	Name      string    `json:"name"`
+	Encrypted bool      `json:"encrypted"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Caminho do backup guardado. Só aceita nomes gerados pelo sistema (sem "/" nem "..").
+func storedBackupPath(name string) (string, bool) {
+	if !storedBackupName.MatchString(name) {
+		return "", false
+	}
+	return filepath.Join(config.GetBackupDir(), name), true
+}
+
+// Backups guardados, do mais novo para o mais antigo
+func listStoredBackups() ([]storedBackup, error) {
+	entries, err := os.ReadDir(config.GetBackupDir())
+	if os.IsNotExist(err) {
+		return []storedBackup{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []storedBackup{}
+	for _, e := range entries {
+		m := storedBackupName.FindStringSubmatch(e.Name())
+		if m == nil || e.IsDir() {
+			continue
+		}
+		created, err := time.ParseInLocation(storedBackupLayout, m[1], time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, storedBackup{Name: e.Name(), Encrypted: m[2] != "", Size: info.Size(), CreatedAt: created})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// Avô-pai-filho: mantém o backup mais recente de cada um dos últimos N dias,
+// N semanas e N meses. A lista deve estar do mais novo para o mais antigo.
+func backupsToKeep(backups []storedBackup, keep config.BackupRetention) map[string]bool {
+	kept := map[string]bool{}
+	if len(backups) > 0 {
+		kept[backups[0].Name] = true // O mais recente nunca é apagado
+	}
+	pick := func(limit int, period func(time.Time) string) {
+		seen := map[string]bool{}
+		for _, b := range backups {
+			if len(seen) >= limit {
+				return
+			}
+			key := period(b.CreatedAt)
+			if !seen[key] {
+				seen[key] = true
+				kept[b.Name] = true
+			}
+		}
+	}
+	pick(keep.Daily, func(t time.Time) string { return t.Format(dateLayout) })
+	pick(keep.Weekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	})
+	pick(keep.Monthly, func(t time.Time) string { return t.Format(monthLayout) })
+	return kept
+}
+
+// Apaga os backups fora da política de retenção
+func pruneStoredBackups() ([]string, error) {
+	backups, err := listStoredBackups()
+	if err != nil {
+		return nil, err
+	}
+	kept := backupsToKeep(backups, config.GetBackupRetention())
+
+	var removed []string
+	for _, b := range backups {
+		if kept[b.Name] {
+			continue
+		}
+		path, _ := storedBackupPath(b.Name)
+		if err := os.Remove(path); err != nil {
+			log.Printf("❌ Erro ao apagar backup antigo %s: %v", b.Name, err)
+			continue
+		}
+		removed = append(removed, b.Name)
+	}
+	return removed, nil
+}
+
+// Grava um backup completo em BACKUP_DIR (cifrado se houver senha) e aplica a retenção.
+// O arquivo é escrito com nome temporário e só aparece na lista quando termina.
+func runStoredBackup(passphrase string, progress progressFunc) (storedBackup, []string, error) {
+	if !storedBackupMu.TryLock() {
+		return storedBackup{}, nil, fmt.Errorf("já existe um backup em andamento")
+	}
+	defer storedBackupMu.Unlock()
+
+	dir := config.GetBackupDir()
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return storedBackup{}, nil, err
+	}
+
+	countCtx, countCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	_, total, err := backupEstimate(countCtx)
+	countCancel()
+	if err != nil {
+		return storedBackup{}, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backupTimeout(total))
+	defer cancel()
+
+	now := time.Now()
+	name := "backup_oem_" + now.Format(storedBackupLayout) + backupExtension(passphrase)
+	path := filepath.Join(dir, name)
+	tmp, err := os.CreateTemp(dir, ".backup_*.tmp")
+	if err != nil {
+		return storedBackup{}, nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := writeBackup(ctx, tmp, now, passphrase, progress); err != nil {
+		tmp.Close()
+		return storedBackup{}, nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return storedBackup{}, nil, err
+	}
+	info, err := tmp.Stat()
+	tmp.Close()
+	if err != nil {
+		return storedBackup{}, nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return storedBackup{}, nil, err
+	}
+
+	removed, err := pruneStoredBackups()
+	if err != nil {
+		log.Println("❌ Erro ao aplicar retenção dos backups:", err)
+	}
+	return storedBackup{Name: name, Encrypted: passphrase != "", Size: info.Size(), CreatedAt: now.Truncate(time.Second)}, removed, nil
+}
+
+// Inicia os backups automáticos conforme BACKUP_CRON
+func StartBackupScheduler() {
+	expr := config.GetBackupSchedule()
+	if expr == "off" {
+		log.Println("ℹ️ Backups automáticos desativados (BACKUP_CRON=off)")
+		return
+	}
+	schedule, err := cron.Parse(expr)
+	if err != nil {
+		log.Printf("❌ BACKUP_CRON inválido (%s), backups automáticos desativados: %v", expr, err)
+		return
+	}
+
+	go func() {
+		for {
+			next := schedule.Next(time.Now())
+			if next.IsZero() {
+				log.Println("❌ BACKUP_CRON nunca será executado, backups automáticos desativados")
+				return
+			}
+			time.Sleep(time.Until(next))
+
+			backup, removed, err := runStoredBackup(config.GetBackupPassphrase(), nil)
+			if err != nil {
+				log.Println("❌ Erro no backup automático:", err)
+				continue
+			}
+			log.Printf("✅ Backup automático gravado: %s (%d antigos removidos)", backup.Name, len(removed))
+		}
+	}()
+}
+
+// --- BACKUPS GUARDADOS NO SERVIDOR (Admin) ---
+func GetStoredBackups(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	backups, err := listStoredBackups()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao ler a pasta de backups"})
+	}
+	return c.JSON(fiber.Map{
+		"backups":   backups,
+		"schedule":  config.GetBackupSchedule(),
+		"retention": config.GetBackupRetention(),
+	})
+}
+
+// Gera um backup agora, fora do agendamento
+func CreateStoredBackup(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem gerar backup."})
+	}
+
+	backup, removed, err := runStoredBackup(backupPassphrase(c), nil)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao gerar backup: " + err.Error()})
+	}
+	return c.Status(201).JSON(fiber.Map{"backup": backup, "removed": removed})
+}
+
+func DownloadStoredBackup(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem baixar backup."})
+	}
+
+	path, ok := storedBackupPath(c.Params("name"))
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Nome de backup inválido"})
+	}
+	if _, err := os.Stat(path); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Backup não encontrado."})
+	}
+
+	c.Set("Content-Disposition", "attachment; filename="+filepath.Base(path))
+	c.Set("Content-Type", "application/gzip")
+	if strings.HasSuffix(path, ".enc") {
+		c.Set("Content-Type", "application/octet-stream")
+	}
+	return c.SendFile(path)
+}
+
+// Restaura um backup guardado. Aceita as mesmas opções de /restore (dry_run, mode, collections...).
+func RestoreStoredBackup(c *fiber.Ctx) error {
+	username, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem restaurar backup."})
+	}
+
+	path, ok := storedBackupPath(c.Params("name"))
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Nome de backup inválido"})
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Backup não encontrado."})
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao abrir arquivo"})
+	}
+	return restoreAndRespond(c, f, info.Size(), username)
+}
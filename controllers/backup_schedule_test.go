@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/config"
+)
+
+// Backups com o nome igual ao horário, do mais novo para o mais antigo
+func backupsAt(t *testing.T, times ...string) []storedBackup {
+	t.Helper()
+	backups := make([]storedBackup, len(times))
+	for i, value := range times {
+		created, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backups[i] = storedBackup{Name: value, CreatedAt: created}
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups
+}
+
+func TestBackupsToKeep(t *testing.T) {
+	cases := []struct {
+		name    string
+		keep    config.BackupRetention
+		backups []string
+		want    []string
+	}{
+		{
+			name:    "mais recente de cada dia",
+			keep:    config.BackupRetention{Daily: 2},
+			backups: []string{"2026-03-10 23:00", "2026-03-10 01:00", "2026-03-09 12:00", "2026-03-08 12:00"},
+			want:    []string{"2026-03-10 23:00", "2026-03-09 12:00"},
+		},
+		{
+			name:    "virada do dia",
+			keep:    config.BackupRetention{Daily: 2},
+			backups: []string{"2026-03-10 00:00", "2026-03-09 23:59", "2026-03-09 10:00"},
+			want:    []string{"2026-03-10 00:00", "2026-03-09 23:59"},
+		},
+		{
+			name:    "semana começa na segunda",
+			keep:    config.BackupRetention{Weekly: 2},
+			backups: []string{"2026-03-16 00:30", "2026-03-15 23:00", "2026-03-09 08:00", "2026-03-08 08:00"},
+			want:    []string{"2026-03-16 00:30", "2026-03-15 23:00"},
+		},
+		{
+			// 28/12/2026 a 03/01/2027 é a semana 53 de 2026
+			name:    "semana ISO na virada do ano",
+			keep:    config.BackupRetention{Weekly: 3},
+			backups: []string{"2027-01-04 10:00", "2027-01-02 10:00", "2026-12-28 10:00", "2026-12-27 10:00"},
+			want:    []string{"2027-01-04 10:00", "2027-01-02 10:00", "2026-12-27 10:00"},
+		},
+		{
+			name:    "virada do mês",
+			keep:    config.BackupRetention{Monthly: 2},
+			backups: []string{"2026-04-01 00:00", "2026-03-31 23:59", "2026-03-01 00:00", "2026-02-28 12:00"},
+			want:    []string{"2026-04-01 00:00", "2026-03-31 23:59"},
+		},
+		{
+			name:    "políticas somadas",
+			keep:    config.BackupRetention{Daily: 1, Weekly: 2, Monthly: 3},
+			backups: []string{"2026-03-10 12:00", "2026-03-10 08:00", "2026-03-04 12:00", "2026-03-02 12:00", "2026-02-20 12:00", "2026-01-15 12:00", "2025-12-31 12:00"},
+			want:    []string{"2026-03-10 12:00", "2026-03-04 12:00", "2026-02-20 12:00", "2026-01-15 12:00"},
+		},
+		{
+			name:    "menos backups que o limite",
+			keep:    config.BackupRetention{Daily: 7, Weekly: 4, Monthly: 12},
+			backups: []string{"2026-03-10 12:00", "2026-03-09 12:00"},
+			want:    []string{"2026-03-10 12:00", "2026-03-09 12:00"},
+		},
+		{
+			name:    "tudo zerado mantém só o mais recente",
+			keep:    config.BackupRetention{},
+			backups: []string{"2026-03-08 12:00", "2026-03-10 12:00", "2026-03-09 12:00"},
+			want:    []string{"2026-03-10 12:00"},
+		},
+		{
+			name:    "um por mês fica com o mais recente",
+			keep:    config.BackupRetention{Monthly: 1},
+			backups: []string{"2026-03-10 12:00", "2026-03-10 08:00"},
+			want:    []string{"2026-03-10 12:00"},
+		},
+		{
+			name:    "sem backups",
+			keep:    config.BackupRetention{Daily: 7},
+			backups: nil,
+			want:    nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			kept := backupsToKeep(backupsAt(t, tc.backups...), tc.keep)
+
+			var got []string
+			for name := range kept {
+				got = append(got, name)
+			}
+			sort.Sort(sort.Reverse(sort.StringSlice(got)))
+			if strings.Join(got, ", ") != strings.Join(tc.want, ", ") {
+				t.Fatalf("mantidos = [%s], esperado [%s]", strings.Join(got, ", "), strings.Join(tc.want, ", "))
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const monthLayout = "2006-01"
+
+// Categorias aceitas na meta e o valor realizado de cada uma
+var budgetCategories = map[string]func(models.Trip) float64{
+	"total":             func(t models.Trip) float64 { return t.TotalExpenses() },
+	"expense_fuel":      func(t models.Trip) float64 { return t.ExpenseFuel },
+	"expense_daily":     func(t models.Trip) float64 { return t.ExpenseDaily },
+	"expense_assistant": func(t models.Trip) float64 { return t.ExpenseAssistant },
+	"expense_toll":      func(t models.Trip) float64 { return t.ExpenseToll },
+	"expense_other":     func(t models.Trip) float64 { return t.ExpenseOther },
+}
+
+// --- METAS DE GASTO (Admin) ---
+// ?month=YYYY-MM (opcional)
+func GetBudgets(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	filter := bson.M{}
+	if month := c.Query("month"); month != "" {
+		filter["month"] = month
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "month", Value: -1}, {Key: "route", Value: 1}, {Key: "cost_center", Value: 1}})
+	var budgets []models.Budget
+	cursor, err := Db.Collection("budgets").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar metas"})
+	}
+	cursor.All(ctx, &budgets)
+
+	if budgets == nil {
+		budgets = []models.Budget{}
+	}
+	return c.JSON(budgets)
+}
+
+// Uma meta por rota/centro de custo + mês + categoria (upsert)
+func SaveBudget(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	var input models.Budget
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Dados inválidos"})
+	}
+
+	if (input.Route == "") == (input.CostCenter == "") {
+		return c.Status(400).JSON(fiber.Map{"error": "Informe a rota ou o centro de custo (apenas um)"})
+	}
+	if _, err := time.Parse(monthLayout, input.Month); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Mês inválido (use AAAA-MM)"})
+	}
+	if input.Category == "" {
+		input.Category = "total"
+	}
+	if _, ok := budgetCategories[input.Category]; !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Categoria inválida"})
+	}
+	if input.Amount <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "O valor da meta deve ser maior que zero"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := bson.M{"route": input.Route, "cost_center": input.CostCenter, "month": input.Month, "category": input.Category}
+	if input.Route == "" {
+		key["route"] = bson.M{"$exists": false}
+	} else {
+		key["cost_center"] = bson.M{"$exists": false}
+	}
+
+	update := bson.M{
+		"$set":         bson.M{"amount": input.Amount},
+		"$setOnInsert": bson.M{"created_at": time.Now()},
+	}
+	_, err := Db.Collection("budgets").UpdateOne(ctx, key, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar meta"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Salvo com sucesso"})
+}
+
+func DeleteBudget(c *fiber.Ctx) error {
+	return deleteAdminDocument(c, "budgets", "Meta não encontrada.")
+}
+
+// Compara as metas do mês com as despesas das viagens aprovadas
+func buildBudgetReport(ctx context.Context, month time.Time, now time.Time) (models.BudgetReport, error) {
+	first := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, now.Location())
+	last := first.AddDate(0, 1, -1)
+
+	report := models.BudgetReport{
+		Month:      first.Format(monthLayout),
+		MonthDays:  last.Day(),
+		Budgets:    []models.BudgetVariance{},
+		Unbudgeted: []models.UnbudgetedExpense{},
+	}
+
+	// Dias decorridos: mês passado conta inteiro, mês futuro ainda não começou
+	switch {
+	case now.Before(first):
+		report.ElapsedDays = 0
+	case now.After(last.AddDate(0, 0, 1)):
+		report.ElapsedDays = report.MonthDays
+	default:
+		report.ElapsedDays = now.Day()
+	}
+
+	var budgets []models.Budget
+	cursor, err := Db.Collection("budgets").Find(ctx, bson.M{"month": report.Month})
+	if err != nil {
+		return report, err
+	}
+	if err := cursor.All(ctx, &budgets); err != nil {
+		return report, err
+	}
+
+	var routes []models.Route
+	cursor, err = Db.Collection("routes").Find(ctx, bson.M{})
+	if err != nil {
+		return report, err
+	}
+	if err := cursor.All(ctx, &routes); err != nil {
+		return report, err
+	}
+	costCenters := map[string]string{}
+	for _, r := range routes {
+		costCenters[r.Name] = r.CostCenter
+	}
+
+	filter := bson.M{"approved": true}
+	applyPeriodFilter(filter, first, last)
+	var trips []models.Trip
+	cursor, err = Db.Collection("trips").Find(ctx, filter)
+	if err != nil {
+		return report, err
+	}
+	if err := cursor.All(ctx, &trips); err != nil {
+		return report, err
+	}
+
+	budgetedRoutes := map[string]bool{}
+	budgetedCenters := map[string]bool{}
+	for _, b := range budgets {
+		if b.Category == "total" && b.Route == "" {
+			budgetedCenters[b.CostCenter] = true
+		}
+	}
+
+	for _, b := range budgets {
+		v := models.BudgetVariance{Budget: b}
+		valueOf := budgetCategories[b.Category]
+		for _, t := range trips {
+			if (b.Route != "" && t.Route == b.Route) || (b.CostCenter != "" && costCenters[t.Route] == b.CostCenter) {
+				v.Trips++
+				v.Actual += valueOf(t)
+			}
+		}
+
+		v.Actual = round2(v.Actual)
+		v.Variance = round2(v.Actual - b.Amount)
+		v.VariancePct = v.Variance / b.Amount
+
+		v.Forecast = v.Actual
+		if report.ElapsedDays > 0 {
+			v.Forecast = round2(v.Actual / float64(report.ElapsedDays) * float64(report.MonthDays))
+		}
+		v.ForecastVariance = round2(v.Forecast - b.Amount)
+		v.ForecastVariancePct = v.ForecastVariance / b.Amount
+
+		switch {
+		case v.Actual > b.Amount:
+			v.Status = "over"
+		case v.Forecast > b.Amount:
+			v.Status = "at_risk"
+		default:
+			v.Status = "under"
+		}
+
+		// Os totais consideram só as metas gerais para não contar a mesma despesa duas vezes.
+		// Meta geral de rota cujo centro de custo também tem meta geral já está na do centro.
+		if b.Category == "total" {
+			if b.Route != "" {
+				budgetedRoutes[b.Route] = true
+			}
+			if b.Route == "" || !budgetedCenters[costCenters[b.Route]] {
+				report.TotalBudget += b.Amount
+				report.TotalActual += v.Actual
+				report.TotalForecast += v.Forecast
+			}
+		}
+
+		report.Budgets = append(report.Budgets, v)
+	}
+
+	// Rotas com gasto no mês sem meta geral (nem própria nem do centro de custo)
+	unbudgeted := map[string]*models.UnbudgetedExpense{}
+	for _, t := range trips {
+		if budgetedRoutes[t.Route] || (costCenters[t.Route] != "" && budgetedCenters[costCenters[t.Route]]) {
+			continue
+		}
+		u, ok := unbudgeted[t.Route]
+		if !ok {
+			u = &models.UnbudgetedExpense{Route: t.Route}
+			unbudgeted[t.Route] = u
+		}
+		u.Trips++
+		u.Actual += t.TotalExpenses()
+	}
+	for _, u := range unbudgeted {
+		u.Actual = round2(u.Actual)
+		report.Unbudgeted = append(report.Unbudgeted, *u)
+	}
+	sort.Slice(report.Unbudgeted, func(i, j int) bool { return report.Unbudgeted[i].Actual > report.Unbudgeted[j].Actual })
+
+	// Maiores estouros primeiro
+	sort.SliceStable(report.Budgets, func(i, j int) bool {
+		return report.Budgets[i].ForecastVariancePct > report.Budgets[j].ForecastVariancePct
+	})
+
+	report.TotalBudget = round2(report.TotalBudget)
+	report.TotalActual = round2(report.TotalActual)
+	report.TotalForecast = round2(report.TotalForecast)
+	return report, nil
+}
+
+// --- ORÇADO x REALIZADO (Admin) ---
+// ?month=YYYY-MM (padrão: mês corrente)
+func GetBudgetVariance(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	now := time.Now()
+	month := now
+	if m := c.Query("month"); m != "" {
+		parsed, err := time.Parse(monthLayout, m)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Mês inválido (use AAAA-MM)"})
+		}
+		month = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report, err := buildBudgetReport(ctx, month, now)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao gerar relatório de metas"})
+	}
+	return c.JSON(report)
+}
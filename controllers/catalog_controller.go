@@ -69,6 +69,23 @@ func GetRoutes(c *fiber.Ctx) error {
 	return c.JSON(routes)
 }
 
+func GetAssistants(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var assistants []models.Assistant
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+
+	cursor, _ := Db.Collection("assistants").Find(ctx, bson.M{}, opts)
+	cursor.All(ctx, &assistants)
+
+	if assistants == nil {
+		assistants = []models.Assistant{}
+	}
+	return c.JSON(assistants)
+}
+
 // --- SAVE (Criar ou Editar - Apenas Admin deve ter acesso no Front, mas a rota existe) ---
 
 func SaveDriver(c *fiber.Ctx) error {
@@ -84,7 +101,11 @@ func SaveDriver(c *fiber.Ctx) error {
 		input.ID = primitive.NewObjectID()
 		Db.Collection("drivers").InsertOne(ctx, input)
 	} else {
-		Db.Collection("drivers").UpdateOne(ctx, bson.M{"_id": input.ID}, bson.M{"$set": input})
+		set, err := presentFields(c, input)
+		if err != nil {
+			return c.Status(400).SendString("Erro dados")
+		}
+		Db.Collection("drivers").UpdateOne(ctx, bson.M{"_id": input.ID}, bson.M{"$set": set})
 	}
 	return c.JSON(fiber.Map{"message": "Salvo com sucesso"})
 }
@@ -120,7 +141,36 @@ func SaveRoute(c *fiber.Ctx) error {
 		input.ID = primitive.NewObjectID()
 		Db.Collection("routes").InsertOne(ctx, input)
 	} else {
-		Db.Collection("routes").UpdateOne(ctx, bson.M{"_id": input.ID}, bson.M{"$set": input})
+		// Só os campos enviados: região e centro de custo não somem ao salvar de um cliente antigo
+		set, err := presentFields(c, input)
+		if err != nil {
+			return c.Status(400).SendString("Erro dados")
+		}
+		Db.Collection("routes").UpdateOne(ctx, bson.M{"_id": input.ID}, bson.M{"$set": set})
+	}
+	return c.JSON(fiber.Map{"message": "Salvo com sucesso"})
+}
+
+func SaveAssistant(c *fiber.Ctx) error {
+	// A diária do cadastro é a usada no cálculo das viagens e da folha
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem alterar ajudantes."})
+	}
+
+	var input models.Assistant
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).SendString("Erro dados")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if input.ID.IsZero() {
+		input.ID = primitive.NewObjectID()
+		Db.Collection("assistants").InsertOne(ctx, input)
+	} else {
+		Db.Collection("assistants").UpdateOne(ctx, bson.M{"_id": input.ID}, bson.M{"$set": input})
 	}
 	return c.JSON(fiber.Map{"message": "Salvo com sucesso"})
 }
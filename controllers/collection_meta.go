@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Coleções do backup: as fixas e as do GridFS que existirem no banco
+func backupCollections(ctx context.Context) ([]string, error) {
+	found, err := Db.ListCollectionNames(ctx, bson.M{"name": bson.M{"$regex": gridFSCollection.String()}})
+	if err != nil {
+		return nil, err
+	}
+	names := append([]string{}, collectionsToBackup...)
+	var buckets []string
+	for _, name := range found {
+		if isGridFSCollection(name) {
+			buckets = append(buckets, name)
+		}
+	}
+	sort.Strings(buckets)
+	return append(names, buckets...), nil
+}
+
+// Lê opções e índices da coleção. Coleção inexistente volta sem metadados.
+func collectionMetadata(ctx context.Context, name string) (collectionMeta, error) {
+	var meta collectionMeta
+
+	specs, err := Db.ListCollectionSpecifications(ctx, bson.M{"name": name})
+	if err != nil {
+		return meta, err
+	}
+	if len(specs) == 0 {
+		return meta, nil
+	}
+	if elems, _ := specs[0].Options.Elements(); len(elems) > 0 {
+		meta.Options = specs[0].Options
+	}
+
+	cursor, err := Db.Collection(name).Indexes().List(ctx)
+	if err != nil {
+		return meta, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		if indexName, _ := cursor.Current.Lookup("name").StringValueOK(); indexName == "_id_" {
+			continue
+		}
+		meta.Indexes = append(meta.Indexes, append(bson.Raw(nil), cursor.Current...))
+	}
+	return meta, cursor.Err()
+}
+
+// Cria a coleção com as opções guardadas no backup
+func createCollectionWithOptions(ctx context.Context, name string, opts bson.Raw) error {
+	cmd := bson.D{{Key: "create", Value: name}}
+	elems, err := opts.Elements()
+	if err != nil && len(opts) > 0 {
+		return err
+	}
+	for _, e := range elems {
+		cmd = append(cmd, bson.E{Key: e.Key(), Value: e.Value()})
+	}
+	return Db.RunCommand(ctx, cmd).Err()
+}
+
+// Índice já existente com outra definição (IndexOptionsConflict / IndexKeySpecsConflict)
+func isIndexConflict(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && (cmdErr.Code == 85 || cmdErr.Code == 86)
+}
+
+// Recria os índices, um por vez para o erro indicar qual falhou.
+// Com keepExisting, índice já existente com outra definição é mantido como está.
+func createIndexes(ctx context.Context, collection string, indexes []bson.Raw, keepExisting bool) error {
+	for _, index := range indexes {
+		elems, err := index.Elements()
+		if err != nil {
+			return err
+		}
+		// Índice do clustered é criado junto com a coleção
+		if clustered, _ := index.Lookup("clustered").BooleanOK(); clustered {
+			continue
+		}
+		spec := bson.D{}
+		for _, e := range elems {
+			if e.Key() == "v" || e.Key() == "ns" {
+				continue
+			}
+			spec = append(spec, bson.E{Key: e.Key(), Value: e.Value()})
+		}
+
+		cmd := bson.D{{Key: "createIndexes", Value: collection}, {Key: "indexes", Value: bson.A{spec}}}
+		if err := Db.RunCommand(ctx, cmd).Err(); err != nil {
+			if keepExisting && isIndexConflict(err) {
+				continue
+			}
+			name, _ := index.Lookup("name").StringValueOK()
+			return fmt.Errorf("índice %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,396 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Coluna de um cadastro no CSV.
+// Aliases aceitos no cabeçalho da importação (sem acento, minúsculo).
+type csvColumn struct {
+	Field   string
+	Header  string
+	Aliases []string
+	Bool    bool
+}
+
+// Layout de importação/exportação de cada cadastro
+type catalogCSVSpec struct {
+	Collection string
+	Key        string // Chave natural usada no upsert
+	Sort       string
+	Columns    []csvColumn
+}
+
+var catalogCSVSpecs = map[string]catalogCSVSpec{
+	"drivers": {
+		Collection: "drivers",
+		Key:        "name",
+		Sort:       "name",
+		Columns: []csvColumn{
+			{Field: "name", Header: "Nome", Aliases: []string{"nome", "name", "motorista"}},
+			{Field: "phone", Header: "Telefone", Aliases: []string{"telefone", "phone", "celular"}},
+			{Field: "document", Header: "CPF", Aliases: []string{"cpf", "documento", "document"}},
+			{Field: "active", Header: "Ativo", Aliases: []string{"ativo", "active"}, Bool: true},
+		},
+	},
+	"vehicles": {
+		Collection: "vehicles",
+		Key:        "plate",
+		Sort:       "model",
+		Columns: []csvColumn{
+			{Field: "model", Header: "Modelo", Aliases: []string{"modelo", "model", "veiculo"}},
+			{Field: "plate", Header: "Placa", Aliases: []string{"placa", "plate"}},
+		},
+	},
+	"routes": {
+		Collection: "routes",
+		Key:        "name",
+		Sort:       "name",
+		Columns: []csvColumn{
+			{Field: "name", Header: "Nome", Aliases: []string{"nome", "name", "rota"}},
+			{Field: "region", Header: "Região", Aliases: []string{"regiao", "region"}},
+			{Field: "cost_center", Header: "Centro de custo", Aliases: []string{"centro de custo", "centro_custo", "cost_center"}},
+		},
+	},
+}
+
+// Resultado da importação (também usado no dry-run)
+type csvImportReport struct {
+	Kind      string           `json:"kind"`
+	DryRun    bool             `json:"dry_run"`
+	Rows      int              `json:"rows"`
+	Inserted  int              `json:"inserted"`
+	Updated   int              `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Errors    []csvImportError `json:"errors"`
+}
+
+type csvImportError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// Normaliza a chave natural (nome / placa) para comparação
+func naturalKey(kind, value string) string {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if kind == "vehicles" {
+		value = strings.NewReplacer("-", "", " ", "").Replace(value)
+	}
+	return value
+}
+
+// Remove acentos simples do cabeçalho (Excel costuma mudar a capitalização)
+func normalizeHeader(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	return strings.NewReplacer("á", "a", "â", "a", "ã", "a", "é", "e", "ê", "e", "í", "i", "ó", "o", "ô", "o", "õ", "o", "ú", "u", "ç", "c").Replace(value)
+}
+
+func parseCSVBool(value string) (bool, error) {
+	switch normalizeHeader(value) {
+	case "sim", "s", "true", "1", "ativo", "yes", "x":
+		return true, nil
+	case "nao", "n", "false", "0", "inativo", "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("valor inválido para sim/não: %q", value)
+}
+
+// Planilhas do Excel pt-BR costumam vir em Windows-1252 e com BOM
+func normalizeCSVInput(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if utf8.Valid(data) {
+		return data
+	}
+
+	var buf bytes.Buffer
+	for _, b := range data {
+		buf.WriteRune(rune(b)) // Latin-1 (as letras acentuadas coincidem com o Windows-1252)
+	}
+	return buf.Bytes()
+}
+
+// Detecta ";" (Excel pt-BR) ou "," pela primeira linha
+func detectDelimiter(data []byte) rune {
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+	if bytes.Count(firstLine, []byte(";")) >= bytes.Count(firstLine, []byte(",")) && bytes.Contains(firstLine, []byte(";")) {
+		return ';'
+	}
+	if bytes.Contains(firstLine, []byte("\t")) && !bytes.Contains(firstLine, []byte(",")) {
+		return '\t'
+	}
+	return ','
+}
+
+// --- IMPORTAR CADASTRO VIA CSV (Admin) ---
+// POST /import/:kind (drivers | vehicles | routes), arquivo no campo "file", ?dry_run=true só valida
+func ImportCatalogCSV(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem importar cadastros."})
+	}
+
+	kind := c.Params("kind")
+	spec, ok := catalogCSVSpecs[kind]
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Cadastro desconhecido"})
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Arquivo não enviado"})
+	}
+	f, err := file.Open()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao abrir arquivo"})
+	}
+	defer f.Close()
+
+	raw, err := io.ReadAll(f)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao ler arquivo"})
+	}
+	raw = normalizeCSVInput(raw)
+
+	reader := csv.NewReader(bytes.NewReader(raw))
+	reader.Comma = detectDelimiter(raw)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "CSV inválido: " + err.Error()})
+	}
+	if len(records) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Arquivo vazio"})
+	}
+
+	// 1. Mapeia o cabeçalho para os campos
+	columnIndex := map[string]int{}
+	for i, header := range records[0] {
+		h := normalizeHeader(header)
+		for _, col := range spec.Columns {
+			for _, alias := range col.Aliases {
+				if h == alias {
+					columnIndex[col.Field] = i
+				}
+			}
+		}
+	}
+	if _, ok := columnIndex[spec.Key]; !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Cabeçalho sem a coluna obrigatória: " + spec.Key})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// 2. Carrega o cadastro atual indexado pela chave natural
+	collection := Db.Collection(spec.Collection)
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao ler cadastro atual"})
+	}
+	var existingDocs []bson.M
+	cursor.All(ctx, &existingDocs)
+
+	existing := map[string]bson.M{}
+	for _, doc := range existingDocs {
+		key, _ := doc[spec.Key].(string)
+		existing[naturalKey(kind, key)] = doc
+	}
+
+	// 3. Valida linha a linha
+	report := csvImportReport{Kind: kind, DryRun: c.QueryBool("dry_run", false), Errors: []csvImportError{}}
+	type pendingRow struct {
+		id  primitive.ObjectID
+		doc bson.M
+	}
+	var inserts, updates []pendingRow
+	seen := map[string]int{}
+
+	for i, record := range records[1:] {
+		line := i + 2
+		if len(strings.Join(record, "")) == 0 {
+			continue // Linha em branco
+		}
+		report.Rows++
+
+		doc := bson.M{}
+		rowErr := ""
+		for _, col := range spec.Columns {
+			idx, ok := columnIndex[col.Field]
+			value := ""
+			if ok && idx < len(record) {
+				value = strings.TrimSpace(record[idx])
+			}
+
+			if col.Bool {
+				if !ok || value == "" {
+					continue // Coluna ausente ou célula vazia: mantém o valor atual
+				}
+				b, err := parseCSVBool(value)
+				if err != nil {
+					rowErr = err.Error()
+					break
+				}
+				doc[col.Field] = b
+				continue
+			}
+			if ok {
+				doc[col.Field] = value
+			}
+		}
+
+		keyValue, _ := doc[spec.Key].(string)
+		if rowErr == "" && keyValue == "" {
+			rowErr = "Coluna " + spec.Key + " vazia"
+		}
+		key := naturalKey(kind, keyValue)
+		if rowErr == "" {
+			if first, dup := seen[key]; dup {
+				rowErr = fmt.Sprintf("Registro duplicado (mesma chave da linha %d)", first)
+			}
+		}
+		if rowErr != "" {
+			report.Errors = append(report.Errors, csvImportError{Line: line, Message: rowErr})
+			continue
+		}
+		seen[key] = line
+
+		if kind == "vehicles" {
+			doc["plate"] = strings.ToUpper(keyValue)
+		}
+
+		current, found := existing[key]
+		if !found {
+			if _, ok := doc["active"]; !ok && kind == "drivers" {
+				doc["active"] = true
+			}
+			inserts = append(inserts, pendingRow{id: primitive.NewObjectID(), doc: doc})
+			continue
+		}
+
+		changed := false
+		for field, value := range doc {
+			if current[field] != value {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			report.Unchanged++
+			continue
+		}
+		id, _ := current["_id"].(primitive.ObjectID)
+		updates = append(updates, pendingRow{id: id, doc: doc})
+	}
+
+	report.Inserted = len(inserts)
+	report.Updated = len(updates)
+
+	if report.DryRun {
+		return c.JSON(report)
+	}
+	if len(report.Errors) > 0 {
+		return c.Status(400).JSON(report)
+	}
+
+	// 4. Grava (upsert pela chave natural)
+	for _, row := range inserts {
+		row.doc["_id"] = row.id
+		if _, err := collection.InsertOne(ctx, row.doc); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Erro ao inserir registro"})
+		}
+	}
+	for _, row := range updates {
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": row.id}, bson.M{"$set": row.doc}); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Erro ao atualizar registro"})
+		}
+	}
+
+	return c.JSON(report)
+}
+
+// --- EXPORTAR CADASTRO EM CSV ---
+// GET /export/:kind?sep=; (padrão ";" para abrir direto no Excel pt-BR, também aceita "," e "tab")
+func ExportCatalogCSV(c *fiber.Ctx) error {
+	kind := c.Params("kind")
+	spec, ok := catalogCSVSpecs[kind]
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Cadastro desconhecido"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: spec.Sort, Value: 1}})
+	cursor, err := Db.Collection(spec.Collection).Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao ler cadastro"})
+	}
+	var docs []bson.M
+	cursor.All(ctx, &docs)
+
+	var buf bytes.Buffer
+	buf.WriteString("\xef\xbb\xbf") // BOM: Excel reconhece UTF-8
+
+	writer := csv.NewWriter(&buf)
+	writer.Comma = csvSeparator(c.Query("sep"))
+
+	header := make([]string, len(spec.Columns))
+	for i, col := range spec.Columns {
+		header[i] = col.Header
+	}
+	writer.Write(header)
+
+	for _, doc := range docs {
+		row := make([]string, len(spec.Columns))
+		for i, col := range spec.Columns {
+			if col.Bool {
+				if b, _ := doc[col.Field].(bool); b {
+					row[i] = "Sim"
+				} else {
+					row[i] = "Não"
+				}
+				continue
+			}
+			row[i], _ = doc[col.Field].(string)
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao gerar CSV"})
+	}
+
+	filename := fmt.Sprintf("%s_%s.csv", kind, time.Now().Format("2006-01-02"))
+	c.Set("Content-Disposition", "attachment; filename="+filename)
+	c.Set("Content-Type", "text/csv; charset=utf-8")
+
+	return c.Send(buf.Bytes())
+}
+
+// Separador do CSV exportado (padrão ";")
+func csvSeparator(sep string) rune {
+	switch sep {
+	case ",":
+		return ','
+	case "tab", "\t":
+		return '\t'
+	}
+	return ';'
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"backend/models"
+	"backend/xlsx"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var tripSheetHeader = []string{
+	"Saída", "Retorno", "Rota", "Motorista", "Veículo", "Usuário", "Status",
+	"Km Inicial", "Km Final", "Km Rodados",
+	"Retirado", "Recebido",
+	"Combustível", "Diárias", "Ajudantes", "Pedágio", "Outras", "Total Despesas", "Saldo",
+}
+
+var tripSheetWidths = []float64{11, 11, 24, 22, 20, 14, 10, 11, 11, 11, 13, 13, 13, 13, 13, 13, 13, 15, 14}
+
+// Primeira coluna numérica somada na linha de totais (Km Rodados)
+const tripSheetFirstSum = 9
+
+var routeSheetHeader = []string{"Rota", "Viagens", "Km Rodados", "Retirado", "Recebido", "Despesas", "Saldo"}
+
+func dateCell(value string) xlsx.Cell {
+	parsed, err := parseDate(value)
+	if err != nil {
+		return xlsx.String(value)
+	}
+	return xlsx.Date(parsed)
+}
+
+// Grava a planilha de viagens (aba "Viagens" + aba "Resumo por Rota") lendo direto do cursor
+func writeTripsWorkbook(ctx context.Context, w io.Writer, cursor *mongo.Cursor) error {
+	wb := xlsx.NewWriter(w)
+
+	sheet, err := wb.AddSheet("Viagens", tripSheetWidths)
+	if err != nil {
+		return err
+	}
+	sheet.WriteHeader(tripSheetHeader...)
+
+	byRoute := map[string]*models.ReportTotals{}
+	var total models.ReportTotals
+
+	for cursor.Next(ctx) {
+		var trip models.Trip
+		if err := cursor.Decode(&trip); err != nil {
+			return err
+		}
+
+		status := "Aberta"
+		if trip.Approved {
+			status = "Aprovada"
+		}
+
+		err := sheet.WriteRow(
+			dateCell(trip.StartDate), dateCell(trip.EndDate),
+			xlsx.String(trip.Route), xlsx.String(trip.Driver), xlsx.String(trip.Vehicle), xlsx.String(trip.UserID), xlsx.String(status),
+			xlsx.Integer(trip.KmStart), xlsx.Integer(trip.KmEnd), xlsx.Integer(trip.KmDriven()),
+			xlsx.Currency(trip.ValueWithdraw), xlsx.Currency(trip.ValueReceived),
+			xlsx.Currency(trip.ExpenseFuel), xlsx.Currency(trip.ExpenseDaily), xlsx.Currency(trip.ExpenseAssistant),
+			xlsx.Currency(trip.ExpenseToll), xlsx.Currency(trip.ExpenseOther),
+			xlsx.Currency(trip.TotalExpenses()), xlsx.Currency(trip.Balance()),
+		)
+		if err != nil {
+			return err
+		}
+
+		r, ok := byRoute[trip.Route]
+		if !ok {
+			r = &models.ReportTotals{Key: trip.Route}
+			byRoute[trip.Route] = r
+		}
+		for _, t := range []*models.ReportTotals{r, &total} {
+			t.Trips++
+			t.KmDriven += trip.KmDriven()
+			t.ValueWithdraw += trip.ValueWithdraw
+			t.ValueReceived += trip.ValueReceived
+			t.ExpenseFuel += trip.ExpenseFuel
+			t.ExpenseDaily += trip.ExpenseDaily
+			t.ExpenseAssistant += trip.ExpenseAssistant
+			t.ExpenseToll += trip.ExpenseToll
+			t.ExpenseOther += trip.ExpenseOther
+			t.ExpenseTotal += trip.TotalExpenses()
+			t.Balance += trip.Balance()
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	// Linha de totais com fórmulas (valor já calculado para leitores sem recálculo)
+	lastRow := sheet.NextRow() - 1
+	cached := []float64{
+		total.KmDriven, total.ValueWithdraw, total.ValueReceived,
+		total.ExpenseFuel, total.ExpenseDaily, total.ExpenseAssistant, total.ExpenseToll, total.ExpenseOther,
+		total.ExpenseTotal, total.Balance,
+	}
+	totalsRow := make([]xlsx.Cell, tripSheetFirstSum, len(tripSheetHeader))
+	for i := range totalsRow {
+		totalsRow[i] = xlsx.Empty()
+	}
+	totalsRow[0] = xlsx.Bold(fmt.Sprintf("TOTAL (%d viagens)", total.Trips))
+	for i, value := range cached {
+		col := xlsx.ColumnName(tripSheetFirstSum + i)
+		style := xlsx.StyleCurrencyBold
+		if i == 0 {
+			style = xlsx.StyleDecimalBold
+		}
+		totalsRow = append(totalsRow, xlsx.Formula(fmt.Sprintf("SUM(%s2:%s%d)", col, col, lastRow), value, style))
+	}
+	sheet.WriteRow(totalsRow...)
+
+	// Aba de resumo por rota
+	routes, err := wb.AddSheet("Resumo por Rota", []float64{28, 10, 12, 14, 14, 14, 14})
+	if err != nil {
+		return err
+	}
+	routes.WriteHeader(routeSheetHeader...)
+
+	keys := make([]string, 0, len(byRoute))
+	for key := range byRoute {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		r := byRoute[key]
+		routes.WriteRow(
+			xlsx.String(r.Key), xlsx.Integer(float64(r.Trips)), xlsx.Integer(r.KmDriven),
+			xlsx.Currency(r.ValueWithdraw), xlsx.Currency(r.ValueReceived), xlsx.Currency(r.ExpenseTotal), xlsx.Currency(r.Balance),
+		)
+	}
+	routes.WriteRow(
+		xlsx.Bold("TOTAL"), xlsx.Integer(float64(total.Trips)).WithStyle(xlsx.StyleDecimalBold), xlsx.Integer(total.KmDriven).WithStyle(xlsx.StyleDecimalBold),
+		xlsx.Currency(total.ValueWithdraw).WithStyle(xlsx.StyleCurrencyBold), xlsx.Currency(total.ValueReceived).WithStyle(xlsx.StyleCurrencyBold),
+		xlsx.Currency(total.ExpenseTotal).WithStyle(xlsx.StyleCurrencyBold), xlsx.Currency(total.Balance).WithStyle(xlsx.StyleCurrencyBold),
+	)
+
+	return wb.Close()
+}
+
+// --- EXPORTAR VIAGENS EM XLSX ---
+// Mesmos filtros e escopo de GetAllTrips (?from=&to=&route=&driver=&vehicle=&user=&status=)
+func ExportTripsXLSX(c *fiber.Ctx) error {
+	username, isAdmin := getUserFromToken(c)
+	if username == "" && !isAdmin {
+		return c.Status(401).JSON(fiber.Map{"error": "Usuário não identificado"})
+	}
+
+	filter, err := tripQueryFromCtx(c).filter(username, isAdmin)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Período inválido"})
+	}
+
+	// O contexto vive até o fim do streaming, que acontece depois do handler retornar
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+
+	opts := options.Find().SetSort(bson.D{{Key: "start_date", Value: 1}})
+	cursor, err := Db.Collection("trips").Find(ctx, filter, opts)
+	if err != nil {
+		cancel()
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar viagens"})
+	}
+
+	filename := fmt.Sprintf("viagens_%s.xlsx", time.Now().Format("2006-01-02_15-04"))
+	c.Set("Content-Disposition", "attachment; filename="+filename)
+	c.Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		defer cursor.Close(ctx)
+
+		if err := writeTripsWorkbook(ctx, w, cursor); err != nil {
+			log.Println("❌ Erro ao gerar planilha de viagens:", err)
+		}
+		w.Flush()
+	})
+	return nil
+}
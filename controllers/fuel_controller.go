@@ -0,0 +1,335 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Desvio máximo aceito entre o consumo da viagem e a média do veículo (20%)
+const defaultFuelDeviationThreshold = 0.20
+
+// Mínimo de viagens anteriores para a média do veículo ser confiável
+const minFuelHistory = 3
+
+// Valida os abastecimentos e recalcula ExpenseFuel a partir deles
+func applyRefuels(trip *models.Trip) error {
+	if len(trip.Refuels) == 0 {
+		return nil
+	}
+
+	total := 0.0
+	for _, r := range trip.Refuels {
+		if r.Liters <= 0 || r.PricePerLiter < 0 {
+			return errors.New("Abastecimento com litros ou preço inválido")
+		}
+		if r.Date != "" {
+			if _, err := parseDate(r.Date); err != nil {
+				return errors.New("Abastecimento com data inválida")
+			}
+		}
+		total += r.Amount()
+	}
+
+	trip.ExpenseFuel = math.Round(total*100) / 100
+	return nil
+}
+
+// Chave de agrupamento do veículo (texto livre na viagem)
+func vehicleKey(vehicle string) string {
+	return strings.ToUpper(strings.TrimSpace(vehicle))
+}
+
+// Km/l de tanque cheio a tanque cheio.
+// Os litros de abastecimentos parciais entram no tanque seguinte.
+func computeTankConsumption(refuels []models.Refuel) []models.TankConsumption {
+	sorted := make([]models.Refuel, len(refuels))
+	copy(sorted, refuels)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Odometer < sorted[j].Odometer })
+
+	tanks := []models.TankConsumption{}
+	lastFull := -1
+	liters := 0.0
+	for i, r := range sorted {
+		if lastFull >= 0 {
+			liters += r.Liters
+		}
+		if !r.FullTank || r.Odometer <= 0 {
+			continue
+		}
+		if lastFull >= 0 {
+			km := r.Odometer - sorted[lastFull].Odometer
+			if km > 0 && liters > 0 {
+				tanks = append(tanks, models.TankConsumption{
+					FromOdometer: sorted[lastFull].Odometer,
+					ToOdometer:   r.Odometer,
+					Date:         r.Date,
+					Km:           km,
+					Liters:       liters,
+					KmPerLiter:   km / liters,
+				})
+			}
+		}
+		lastFull = i
+		liters = 0
+	}
+	return tanks
+}
+
+func kmPerLiter(km, liters float64) float64 {
+	if km <= 0 || liters <= 0 {
+		return 0
+	}
+	return km / liters
+}
+
+// Monta o consumo da viagem (sem comparação com o histórico)
+func tripConsumption(trip models.Trip) models.TripConsumption {
+	cost := 0.0
+	for _, r := range trip.Refuels {
+		cost += r.Amount()
+	}
+
+	return models.TripConsumption{
+		TripID:     trip.ID.Hex(),
+		Vehicle:    trip.Vehicle,
+		Route:      trip.Route,
+		StartDate:  trip.StartDate,
+		Km:         trip.KmDriven(),
+		Liters:     trip.FuelLiters(),
+		FuelCost:   cost,
+		KmPerLiter: kmPerLiter(trip.KmDriven(), trip.FuelLiters()),
+		Tanks:      computeTankConsumption(trip.Refuels),
+	}
+}
+
+// Compara o consumo da viagem com a média das OUTRAS viagens do mesmo veículo
+func compareWithHistory(tc *models.TripConsumption, history []models.TripConsumption, threshold float64) {
+	sum, count := 0.0, 0
+	for _, h := range history {
+		if h.TripID == tc.TripID || h.KmPerLiter <= 0 {
+			continue
+		}
+		sum += h.KmPerLiter
+		count++
+	}
+	if count < minFuelHistory || tc.KmPerLiter <= 0 {
+		return
+	}
+
+	tc.VehicleAverage = sum / float64(count)
+	tc.Deviation = (tc.KmPerLiter - tc.VehicleAverage) / tc.VehicleAverage
+	tc.Flagged = math.Abs(tc.Deviation) > threshold
+}
+
+// Busca as viagens com abastecimento do filtro, agrupadas por veículo
+func fuelHistoryByVehicle(ctx context.Context, filter bson.M) (map[string][]models.TripConsumption, error) {
+	filter["refuels.0"] = bson.M{"$exists": true}
+	opts := options.Find().SetSort(bson.D{{Key: "start_date", Value: 1}})
+	cursor, err := Db.Collection("trips").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var trips []models.Trip
+	if err := cursor.All(ctx, &trips); err != nil {
+		return nil, err
+	}
+
+	history := map[string][]models.TripConsumption{}
+	for _, trip := range trips {
+		key := vehicleKey(trip.Vehicle)
+		history[key] = append(history[key], tripConsumption(trip))
+	}
+	return history, nil
+}
+
+// Viagens com o mesmo veículo (mesma chave de vehicleKey)
+func sameVehicleFilter(vehicle string) bson.M {
+	pattern := `^\s*` + regexp.QuoteMeta(strings.TrimSpace(vehicle)) + `\s*$`
+	return bson.M{"vehicle": primitive.Regex{Pattern: pattern, Options: "i"}}
+}
+
+func thresholdFromQuery(c *fiber.Ctx) float64 {
+	threshold := c.QueryFloat("threshold", defaultFuelDeviationThreshold)
+	if threshold <= 0 {
+		threshold = defaultFuelDeviationThreshold
+	}
+	return threshold
+}
+
+// --- CONSUMO DE UMA VIAGEM ---
+func GetTripConsumption(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	username, isAdmin := getUserFromToken(c)
+
+	var trip models.Trip
+	if err := Db.Collection("trips").FindOne(ctx, bson.M{"_id": objID}).Decode(&trip); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Viagem não encontrada"})
+	}
+
+	if !isAdmin && trip.UserID != username {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso negado a este registro."})
+	}
+
+	history, err := fuelHistoryByVehicle(ctx, sameVehicleFilter(trip.Vehicle))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar histórico de consumo"})
+	}
+
+	result := tripConsumption(trip)
+	compareWithHistory(&result, history[vehicleKey(trip.Vehicle)], thresholdFromQuery(c))
+
+	return c.JSON(result)
+}
+
+// --- CONSUMO POR VEÍCULO AO LONGO DO TEMPO ---
+func GetVehicleConsumption(c *fiber.Ctx) error {
+	from, to, err := periodFromQuery(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Período inválido"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"refuels.0": bson.M{"$exists": true}}
+	applyPeriodFilter(filter, from, to)
+
+	// Usuário comum só vê as próprias viagens (igual GetAllTrips)
+	username, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		filter["user_id"] = username
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "start_date", Value: 1}})
+	cursor, err := Db.Collection("trips").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar viagens"})
+	}
+
+	var trips []models.Trip
+	cursor.All(ctx, &trips)
+
+	vehicles := map[string]*models.VehicleConsumption{}
+	months := map[string]map[string]*models.MonthConsumption{}
+	refuels := map[string][]models.Refuel{}
+	var order []string
+
+	for _, trip := range trips {
+		key := vehicleKey(trip.Vehicle)
+		vc, ok := vehicles[key]
+		if !ok {
+			vc = &models.VehicleConsumption{Vehicle: trip.Vehicle}
+			vehicles[key] = vc
+			months[key] = map[string]*models.MonthConsumption{}
+			order = append(order, key)
+		}
+
+		tc := tripConsumption(trip)
+		vc.Trips++
+		vc.Km += tc.Km
+		vc.Liters += tc.Liters
+		vc.FuelCost += tc.FuelCost
+		refuels[key] = append(refuels[key], trip.Refuels...)
+
+		month := trip.StartDate
+		if len(month) >= 7 {
+			month = month[:7]
+		}
+		mc, ok := months[key][month]
+		if !ok {
+			mc = &models.MonthConsumption{Month: month}
+			months[key][month] = mc
+		}
+		mc.Km += tc.Km
+		mc.Liters += tc.Liters
+		mc.FuelCost += tc.FuelCost
+	}
+
+	result := []models.VehicleConsumption{}
+	for _, key := range order {
+		vc := vehicles[key]
+		vc.KmPerLiter = kmPerLiter(vc.Km, vc.Liters)
+		vc.Tanks = computeTankConsumption(refuels[key])
+
+		vc.Months = []models.MonthConsumption{}
+		for _, mc := range months[key] {
+			mc.KmPerLiter = kmPerLiter(mc.Km, mc.Liters)
+			vc.Months = append(vc.Months, *mc)
+		}
+		sort.Slice(vc.Months, func(i, j int) bool { return vc.Months[i].Month < vc.Months[j].Month })
+
+		result = append(result, *vc)
+	}
+
+	return c.JSON(result)
+}
+
+// --- VIAGENS COM CONSUMO FORA DO PADRÃO DO VEÍCULO (Admin) ---
+// ?threshold=0.2 (20%) e período opcional ?from=&to=
+func GetFuelAnomalies(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem ver esta análise."})
+	}
+
+	from, to, err := periodFromQuery(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Período inválido"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	history, err := fuelHistoryByVehicle(ctx, bson.M{})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar histórico de consumo"})
+	}
+
+	threshold := thresholdFromQuery(c)
+	fromStr, toStr := "", ""
+	if !from.IsZero() {
+		fromStr = from.Format(dateLayout)
+	}
+	if !to.IsZero() {
+		toStr = to.AddDate(0, 0, 1).Format(dateLayout)
+	}
+
+	flagged := []models.TripConsumption{}
+	for _, trips := range history {
+		for _, tc := range trips {
+			if (fromStr != "" && tc.StartDate < fromStr) || (toStr != "" && tc.StartDate >= toStr) {
+				continue
+			}
+			compareWithHistory(&tc, trips, threshold)
+			if tc.Flagged {
+				flagged = append(flagged, tc)
+			}
+		}
+	}
+
+	sort.Slice(flagged, func(i, j int) bool {
+		return math.Abs(flagged[i].Deviation) > math.Abs(flagged[j].Deviation)
+	})
+
+	return c.JSON(flagged)
+}
@@ -0,0 +1,389 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Formato padrão das datas gravadas como texto (inputs type="date" do front)
+const dateLayout = "2006-01-02"
+
+// Aceita as variações de data que o front já enviou ao longo do tempo
+var dateLayouts = []string{dateLayout, "2006-01-02T15:04", "2006-01-02T15:04:05", time.RFC3339, "02/01/2006"}
+
+// Converte uma data em texto (Ex: start_date) para time.Time
+func parseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if parsed, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("data inválida: %q", value)
+}
+
+// Filtro de viagens de um veículo do cadastro.
+// A viagem guarda o veículo como texto livre (modelo e/ou placa), então buscamos pela
+// placa inteira: "ABC1234" não casa com "ABC12345". Sem placa não há como identificar
+// as viagens do veículo (o modelo se repete na frota) e ok volta false.
+func tripVehicleFilter(vehicle models.Vehicle) (bson.M, bool) {
+	plate := strings.TrimSpace(vehicle.Plate)
+	if plate == "" {
+		return nil, false
+	}
+	pattern := `(^|[^0-9A-Za-z])` + regexp.QuoteMeta(plate) + `([^0-9A-Za-z]|$)`
+	return bson.M{"vehicle": primitive.Regex{Pattern: pattern, Options: "i"}}, true
+}
+
+// Lê o período de ?from=&to= (YYYY-MM-DD). Datas vazias = sem limite.
+func periodFromQuery(from, to string) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+	if from != "" {
+		if start, err = parseDate(from); err != nil {
+			return start, end, err
+		}
+	}
+	if to != "" {
+		if end, err = parseDate(to); err != nil {
+			return start, end, err
+		}
+	}
+	return start, end, nil
+}
+
+// Aplica o período no campo start_date (texto ISO, então a comparação é lexicográfica).
+// O fim é inclusivo: vai até o último instante do dia "to".
+func applyPeriodFilter(filter bson.M, from, to time.Time) {
+	rng := bson.M{}
+	if !from.IsZero() {
+		rng["$gte"] = from.Format(dateLayout)
+	}
+	if !to.IsZero() {
+		rng["$lt"] = to.AddDate(0, 0, 1).Format(dateLayout)
+	}
+	if len(rng) > 0 {
+		filter["start_date"] = rng
+	}
+}
+
+// Campos de input enviados no corpo, com os nomes gravados no banco (json e bson iguais).
+// Usado no $set das edições: campo que um cliente antigo não conhece não é apagado.
+func presentFields(c *fiber.Ctx, input interface{}) (bson.M, error) {
+	data, err := bson.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	delete(doc, "_id")
+
+	var sent map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &sent); err != nil {
+		return doc, nil // Corpo de formulário: grava todos os campos, como antes
+	}
+	for key := range doc {
+		if _, ok := sent[key]; !ok {
+			delete(doc, key)
+		}
+	}
+	return doc, nil
+}
+
+// Exclusão simples por :id, restrita a administradores
+func deleteAdminDocument(c *fiber.Ctx, collectionName, notFound string) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+	}
+
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem excluir registros."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := Db.Collection(collectionName).DeleteOne(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao excluir"})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": notFound})
+	}
+
+	return c.JSON(fiber.Map{"message": "Excluído com sucesso!"})
+}
+
+// Filtros comuns das listagens e relatórios de viagens
+type tripQuery struct {
+	From    string `json:"from" bson:"from"`
+	To      string `json:"to" bson:"to"`
+	Route   string `json:"route" bson:"route"`
+	Driver  string `json:"driver" bson:"driver"`
+	Vehicle string `json:"vehicle" bson:"vehicle"`
+	User    string `json:"user" bson:"user"`
+	Status  string `json:"status" bson:"status"` // "approved", "open" ou vazio (todas)
+}
+
+// Lê ?from=&to=&route=&driver=&vehicle=&user=&status=
+func tripQueryFromCtx(c *fiber.Ctx) tripQuery {
+	return tripQuery{
+		From:    c.Query("from"),
+		To:      c.Query("to"),
+		Route:   c.Query("route"),
+		Driver:  c.Query("driver"),
+		Vehicle: c.Query("vehicle"),
+		User:    c.Query("user"),
+		Status:  c.Query("status"),
+	}
+}
+
+// Monta o filtro do Mongo. Usuário comum só enxerga as próprias viagens (igual GetAllTrips).
+func (q tripQuery) filter(username string, isAdmin bool) (bson.M, error) {
+	filter := bson.M{}
+
+	from, to, err := periodFromQuery(q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+	applyPeriodFilter(filter, from, to)
+
+	if q.Route != "" {
+		filter["route"] = q.Route
+	}
+	if q.Driver != "" {
+		filter["driver"] = q.Driver
+	}
+	if q.Vehicle != "" {
+		filter["vehicle"] = q.Vehicle
+	}
+
+	switch q.Status {
+	case "approved":
+		filter["approved"] = true
+	case "open":
+		filter["approved"] = bson.M{"$ne": true}
+	}
+
+	if !isAdmin {
+		filter["user_id"] = username
+	} else if q.User != "" {
+		filter["user_id"] = q.User
+	}
+	return filter, nil
+}
+
+// Marcação das viagens exportadas em lote (contabilidade e folha)
+type exportBatch struct {
+	Field      string // Campo da viagem com o ID do lote
+	ExportedAt string // Campo da viagem com a data da exportação
+	Exported   string // Campo da viagem com os valores enviados (base das correções)
+	Correction string // Campo da viagem reaberta depois de exportada
+	Collection string // Coleção dos lotes
+}
+
+var accountingExport = exportBatch{
+	Field:      "accounting_batch",
+	ExportedAt: "accounting_exported_at",
+	Exported:   "accounting_exported",
+	Correction: "accounting_correction",
+	Collection: "accounting_batches",
+}
+
+var payrollExport = exportBatch{
+	Field:      "payroll_batch",
+	ExportedAt: "payroll_exported_at",
+	Exported:   "payroll_exported",
+	Correction: "payroll_correction",
+	Collection: "payroll_batches",
+}
+
+// Viagem marcada no lote
+type exportMark struct {
+	TripID     primitive.ObjectID
+	Exported   interface{} // Valores enviados até agora (gravados em Exported)
+	Correction bool        // O lote leva só a diferença de uma viagem reaberta
+}
+
+// Outro lote marcou parte das viagens no meio tempo
+var errExportConflict = errors.New("viagens exportadas por outro lote")
+
+// Campos removidos quando a viagem volta a ficar pendente de exportação
+func (e exportBatch) unset() bson.M {
+	return bson.M{e.Field: "", e.ExportedAt: "", e.Exported: "", e.Correction: ""}
+}
+
+// Viagem reaberta: o lote já enviado continua valendo e a próxima exportação leva só a diferença
+func (e exportBatch) flagCorrection(ctx context.Context, tripID primitive.ObjectID) error {
+	_, err := Db.Collection("trips").UpdateOne(ctx, bson.M{"_id": tripID, e.Field: bson.M{"$exists": true}}, bson.M{"$set": bson.M{e.Correction: true}})
+	return err
+}
+
+// Grava o lote e marca as viagens. O lote é gravado antes para nenhuma viagem apontar
+// para um lote inexistente. Sem replace, só marca viagens ainda livres ou correções
+// pendentes (evita corrida entre dois admins); com replace, viagens de lotes antigos
+// passam para o novo. O estado anterior dessas viagens fica no lote (campo replaced),
+// para o cancelamento devolvê-lo. Em qualquer falha desfaz tudo.
+func (e exportBatch) register(ctx context.Context, batchID primitive.ObjectID, batch interface{}, marks []exportMark, exportedAt time.Time, replace bool) error {
+	if _, err := Db.Collection(e.Collection).InsertOne(ctx, batch); err != nil {
+		return err
+	}
+
+	tripIDs := make([]primitive.ObjectID, len(marks))
+	for i, m := range marks {
+		tripIDs[i] = m.TripID
+	}
+
+	var previous []bson.M
+	opts := options.Find().SetProjection(bson.M{e.Field: 1, e.ExportedAt: 1, e.Exported: 1, e.Correction: 1})
+	cursor, err := Db.Collection("trips").Find(ctx, bson.M{"_id": bson.M{"$in": tripIDs}, e.Field: bson.M{"$exists": true}}, opts)
+	if err == nil {
+		err = cursor.All(ctx, &previous)
+	}
+	if err == nil && len(previous) > 0 {
+		_, err = Db.Collection(e.Collection).UpdateOne(ctx, bson.M{"_id": batchID}, bson.M{"$set": bson.M{"replaced": previous}})
+	}
+	if err != nil {
+		Db.Collection(e.Collection).DeleteOne(ctx, bson.M{"_id": batchID})
+		return err
+	}
+
+	writes := make([]mongo.WriteModel, len(marks))
+	for i, m := range marks {
+		filter := bson.M{"_id": m.TripID}
+		switch {
+		case replace:
+		case m.Correction:
+			filter[e.Correction] = true
+		default:
+			filter[e.Field] = bson.M{"$exists": false}
+		}
+		set := bson.M{e.Field: batchID.Hex(), e.ExportedAt: exportedAt}
+		if m.Exported != nil {
+			set[e.Exported] = m.Exported
+		}
+		writes[i] = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(bson.M{"$set": set, "$unset": bson.M{e.Correction: ""}})
+	}
+	result, err := Db.Collection("trips").BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	if err == nil && int(result.ModifiedCount) == len(marks) {
+		return nil
+	}
+
+	e.restore(ctx, batchID, previous)
+	Db.Collection(e.Collection).DeleteOne(ctx, bson.M{"_id": batchID})
+
+	if err != nil {
+		return err
+	}
+	return errExportConflict
+}
+
+// Cancela o lote. As viagens que eram livres voltam a ficar pendentes; as que já estavam
+// em outro lote (correções e reexportações) voltam ao estado anterior.
+func (e exportBatch) release(ctx context.Context, batchID primitive.ObjectID) (bool, error) {
+	var batch struct {
+		Replaced []bson.M `bson:"replaced"`
+	}
+	err := Db.Collection(e.Collection).FindOneAndDelete(ctx, bson.M{"_id": batchID}).Decode(&batch)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, e.restore(ctx, batchID, batch.Replaced)
+}
+
+// Tira as marcas do lote e devolve às viagens o estado anterior
+func (e exportBatch) restore(ctx context.Context, batchID primitive.ObjectID, previous []bson.M) error {
+	if _, err := Db.Collection("trips").UpdateMany(ctx, bson.M{e.Field: batchID.Hex()}, bson.M{"$unset": e.unset()}); err != nil {
+		return err
+	}
+	for _, trip := range previous {
+		set := bson.M{}
+		for key, value := range trip {
+			if key != "_id" {
+				set[key] = value
+			}
+		}
+		_, err := Db.Collection("trips").UpdateOne(ctx, bson.M{"_id": trip["_id"], e.Field: bson.M{"$exists": false}}, bson.M{"$set": set})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Quando nenhum período é informado, relatórios usam o mês corrente
+func (q *tripQuery) defaultToCurrentMonth(now time.Time) {
+	if q.From != "" || q.To != "" {
+		return
+	}
+	first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	q.From = first.Format(dateLayout)
+	q.To = first.AddDate(0, 1, -1).Format(dateLayout)
+}
+
+// Arredonda para centavos
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// Formata valor em reais (Ex: R$ 1.234,56)
+func formatBRL(value float64) string {
+	if value < 0 {
+		return "-R$ " + formatNumberBR(-value, 2)
+	}
+	return "R$ " + formatNumberBR(value, 2)
+}
+
+// Formata número com casas decimais no padrão brasileiro (Ex: 12.345,6)
+func formatNumberBR(value float64, decimals int) string {
+	s := strconv.FormatFloat(value, 'f', decimals, 64)
+	intPart, frac, _ := strings.Cut(s, ".")
+	neg := strings.HasPrefix(intPart, "-")
+	intPart = strings.TrimPrefix(intPart, "-")
+
+	var grouped strings.Builder
+	if neg {
+		grouped.WriteByte('-')
+	}
+	for i, digit := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			grouped.WriteByte('.')
+		}
+		grouped.WriteRune(digit)
+	}
+	if frac != "" {
+		grouped.WriteString("," + frac)
+	}
+	return grouped.String()
+}
+
+// Converte data ISO (YYYY-MM-DD) para o formato brasileiro
+func formatDateBR(value string) string {
+	parsed, err := parseDate(value)
+	if err != nil {
+		return value
+	}
+	return parsed.Format("02/01/2006")
+}
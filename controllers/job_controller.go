@@ -0,0 +1,390 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Backup e restauração em segundo plano. O estado fica na coleção jobs,
+// então o resultado continua disponível depois de recarregar a página.
+
+// Intervalo mínimo entre gravações do andamento
+const jobSaveInterval = time.Second
+
+// Conta os bytes lidos do arquivo para estimar o andamento da restauração
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+type jobTracker struct {
+	id       primitive.ObjectID
+	mu       sync.Mutex
+	progress models.JobProgress
+	read     *countingReader // Restauração: andamento pelo arquivo
+	size     int64
+	saved    time.Time
+}
+
+func newJob(ctx context.Context, jobType, username string, params map[string]string) (models.Job, *jobTracker, error) {
+	job := models.Job{
+		ID:        primitive.NewObjectID(),
+		Type:      jobType,
+		Status:    "queued",
+		Params:    params,
+		Progress:  models.JobProgress{Collections: map[string]int{}, UpdatedAt: time.Now()},
+		CreatedBy: username,
+		CreatedAt: time.Now(),
+	}
+	if _, err := Db.Collection("jobs").InsertOne(ctx, job); err != nil {
+		return job, nil, err
+	}
+	return job, &jobTracker{id: job.ID, progress: job.Progress}, nil
+}
+
+// progressFunc das tarefas: grava no máximo uma vez por segundo ou na troca de fase
+func (t *jobTracker) update(phase, collection string, done int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	changed := phase != t.progress.Phase
+	t.progress.Phase = phase
+	if collection != "" {
+		t.progress.Collections[collection] = done
+	}
+	if changed || time.Since(t.saved) >= jobSaveInterval {
+		t.saveLocked()
+	}
+}
+
+func (t *jobTracker) percentLocked() float64 {
+	var percent float64
+	if t.read != nil && t.size > 0 {
+		percent = float64(t.read.n.Load()) / float64(t.size) * 100
+	} else if len(t.progress.Totals) > 0 {
+		var done, total int
+		for name, n := range t.progress.Totals {
+			total += n
+			done += t.progress.Collections[name]
+		}
+		if total > 0 {
+			percent = float64(done) / float64(total) * 100
+		}
+	}
+	// 100% só quando terminar
+	return min(percent, 99)
+}
+
+func (t *jobTracker) saveLocked() {
+	t.progress.Percent = t.percentLocked()
+	t.progress.UpdatedAt = time.Now()
+	t.saved = t.progress.UpdatedAt
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := Db.Collection("jobs").UpdateOne(ctx, bson.M{"_id": t.id}, bson.M{"$set": bson.M{"progress": t.progress}}); err != nil {
+		log.Println("❌ Erro ao gravar andamento da tarefa:", err)
+	}
+}
+
+// Resumo gravado com os mesmos nomes de campo da resposta JSON
+func jobResult(v interface{}) bson.M {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var result bson.M
+	json.Unmarshal(data, &result)
+	return result
+}
+
+// Executa a tarefa em goroutine e grava o resultado final
+func (t *jobTracker) run(work func() (interface{}, error)) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		started := time.Now()
+		Db.Collection("jobs").UpdateOne(ctx, bson.M{"_id": t.id}, bson.M{"$set": bson.M{"status": "running", "started_at": started}})
+		cancel()
+
+		var result interface{}
+		var err error
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("erro interno: %v", r)
+				}
+			}()
+			result, err = work()
+		}()
+
+		t.mu.Lock()
+		set := bson.M{"finished_at": time.Now()}
+		if result != nil {
+			set["result"] = jobResult(result)
+		}
+		if err != nil {
+			set["status"] = "failed"
+			set["error"] = err.Error()
+			t.progress.Percent = t.percentLocked()
+		} else {
+			set["status"] = "success"
+			t.progress.Percent = 100
+		}
+		t.progress.UpdatedAt = time.Now()
+		set["progress"] = t.progress
+		t.mu.Unlock()
+
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := Db.Collection("jobs").UpdateOne(ctx, bson.M{"_id": t.id}, bson.M{"$set": set}); err != nil {
+			log.Println("❌ Erro ao gravar resultado da tarefa:", err)
+		}
+	}()
+}
+
+// Tarefas que estavam rodando quando o servidor parou não vão terminar
+func RecoverInterruptedJobs() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := Db.Collection("jobs").UpdateMany(ctx,
+		bson.M{"status": bson.M{"$in": bson.A{"queued", "running"}}},
+		bson.M{"$set": bson.M{"status": "failed", "error": "Servidor reiniciado durante a execução", "finished_at": time.Now()}})
+	if err != nil {
+		log.Println("❌ Erro ao verificar tarefas interrompidas:", err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("⚠️ %d tarefa(s) interrompida(s) marcada(s) como falha", result.ModifiedCount)
+	}
+}
+
+// Os valores da query do Fiber só valem durante a requisição; a tarefa precisa de cópias
+func (o restoreOptions) detached() restoreOptions {
+	o.Mode = strings.Clone(o.Mode)
+	o.DocID = strings.Clone(o.DocID)
+	o.Security.Passphrase = strings.Clone(o.Security.Passphrase)
+	collections := make([]string, len(o.Collections))
+	for i, name := range o.Collections {
+		collections[i] = strings.Clone(name)
+	}
+	o.Collections = collections
+	return o
+}
+
+// Opções informadas, guardadas na tarefa (a senha nunca é gravada)
+func jobParams(c *fiber.Ctx, keys ...string) map[string]string {
+	params := map[string]string{}
+	for _, key := range keys {
+		if value := c.Query(key); value != "" {
+			params[key] = strings.Clone(value)
+		}
+	}
+	return params
+}
+
+// --- INICIAR BACKUP EM SEGUNDO PLANO (Admin) ---
+// Grava em BACKUP_DIR, como o backup agendado; o arquivo sai em /api/backups/:name
+func CreateBackupJob(c *fiber.Ctx) error {
+	username, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem gerar backup."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	totals, _, err := backupEstimate(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao ler coleções do backup"})
+	}
+
+	job, tracker, err := newJob(ctx, "backup", username, nil)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao criar tarefa"})
+	}
+	tracker.progress.Totals = totals
+	job.Progress.Totals = totals
+
+	passphrase := strings.Clone(backupPassphrase(c))
+	tracker.run(func() (interface{}, error) {
+		backup, removed, err := runStoredBackup(passphrase, tracker.update)
+		if err != nil {
+			return nil, err
+		}
+		return fiber.Map{"backup": backup, "removed": removed}, nil
+	})
+
+	return c.Status(202).JSON(job)
+}
+
+// --- INICIAR RESTAURAÇÃO EM SEGUNDO PLANO (Admin) ---
+// Arquivo enviado em "backup_file" ou ?name= de um backup guardado no servidor.
+// Aceita as mesmas opções de /restore (dry_run, mode, collections, from, to, id, allow_unsigned).
+func CreateRestoreJob(c *fiber.Ctx) error {
+	username, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem restaurar backup."})
+	}
+
+	opts, err := restoreOptionsFromQuery(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	opts = opts.detached()
+	opts.User = username
+	dryRun := c.QueryBool("dry_run", false)
+
+	// O arquivo enviado precisa sobreviver à requisição: copia para um temporário
+	var path string
+	var temporary bool
+	if name := c.Query("name"); name != "" {
+		stored, ok := storedBackupPath(name)
+		if !ok {
+			return c.Status(400).JSON(fiber.Map{"error": "Nome de backup inválido"})
+		}
+		if _, err := os.Stat(stored); err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Backup não encontrado."})
+		}
+		path = stored
+	} else {
+		file, err := c.FormFile("backup_file")
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Arquivo não enviado"})
+		}
+		tmp, err := os.CreateTemp("", "restore_*.upload")
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Erro ao guardar arquivo"})
+		}
+		tmp.Close()
+		if err := c.SaveFile(file, tmp.Name()); err != nil {
+			os.Remove(tmp.Name())
+			return c.Status(500).JSON(fiber.Map{"error": "Erro ao guardar arquivo"})
+		}
+		path, temporary = tmp.Name(), true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, tracker, err := newJob(ctx, "restore", username, jobParams(c, "name", "dry_run", "mode", "collections", "from", "to", "id", "allow_unsigned"))
+	if err != nil {
+		if temporary {
+			os.Remove(path)
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao criar tarefa"})
+	}
+
+	tracker.run(func() (interface{}, error) {
+		if temporary {
+			defer os.Remove(path)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		tracker.mu.Lock()
+		tracker.read = &countingReader{r: f}
+		tracker.size = info.Size()
+		tracker.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout(info.Size()))
+		defer cancel()
+
+		if dryRun {
+			tracker.update("dry_run", "", 0)
+			diff, err := diffBackup(ctx, tracker.read, opts)
+			return diff, err
+		}
+
+		opts.Progress = tracker.update
+		summary, err := restoreFromReader(ctx, tracker.read, opts)
+		if err != nil {
+			if summary.Mode == restoreMerge && summary.Inserted != nil {
+				return summary, fmt.Errorf("restauração interrompida, parte dos documentos já foi gravada (pode ser repetida): %w", err)
+			}
+			return nil, fmt.Errorf("restauração cancelada, nenhum dado foi alterado: %w", err)
+		}
+		return summary, nil
+	})
+
+	return c.Status(202).JSON(job)
+}
+
+// --- ANDAMENTO DA TAREFA (Admin) ---
+func GetJob(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+	}
+
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var job models.Job
+	if err := Db.Collection("jobs").FindOne(ctx, bson.M{"_id": objID}).Decode(&job); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Tarefa não encontrada."})
+	}
+	return c.JSON(job)
+}
+
+// Últimas tarefas (filtro opcional ?type=backup|restore)
+func GetJobs(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if jobType := c.Query("type"); jobType != "" {
+		filter["type"] = jobType
+	}
+
+	var jobs []models.Job
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(50)
+	cursor, err := Db.Collection("jobs").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar tarefas"})
+	}
+	cursor.All(ctx, &jobs)
+
+	if jobs == nil {
+		jobs = []models.Job{}
+	}
+	return c.JSON(jobs)
+}
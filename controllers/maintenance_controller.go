@@ -0,0 +1,313 @@
+package controllers
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Margens para considerar um plano "vencendo" antes de vencer de fato
+const (
+	maintenanceDueKmRatio = 0.10 // 10% do intervalo em km
+	maintenanceDueDays    = 15
+)
+
+// --- LISTAR PLANOS DE MANUTENÇÃO ---
+func GetMaintenancePlans(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if vehicleID, err := primitive.ObjectIDFromHex(c.Query("vehicle_id")); err == nil {
+		filter["vehicle_id"] = vehicleID
+	}
+
+	var plans []models.MaintenancePlan
+	cursor, err := Db.Collection("maintenance_plans").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "description", Value: 1}}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar planos de manutenção"})
+	}
+	cursor.All(ctx, &plans)
+
+	if plans == nil {
+		plans = []models.MaintenancePlan{}
+	}
+	return c.JSON(plans)
+}
+
+// --- SALVAR PLANO (Admin) ---
+func SaveMaintenancePlan(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem alterar planos de manutenção."})
+	}
+
+	var input models.MaintenancePlan
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Dados inválidos"})
+	}
+
+	if input.VehicleID.IsZero() {
+		return c.Status(400).JSON(fiber.Map{"error": "Informe o veículo"})
+	}
+	if input.IntervalKm <= 0 && input.IntervalMonths <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Informe o intervalo em km e/ou em meses"})
+	}
+	if input.StartDate != "" {
+		start, err := parseDate(input.StartDate)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Data inicial inválida"})
+		}
+		input.StartDate = start.Format(dateLayout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := Db.Collection("maintenance_plans")
+	var err error
+	if input.ID.IsZero() {
+		input.ID = primitive.NewObjectID()
+		input.CreatedAt = time.Now()
+		_, err = collection.InsertOne(ctx, input)
+	} else {
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": input.ID}, bson.M{"$set": bson.M{
+			"vehicle_id":      input.VehicleID,
+			"description":     input.Description,
+			"interval_km":     input.IntervalKm,
+			"interval_months": input.IntervalMonths,
+			"start_km":        input.StartKm,
+			"start_date":      input.StartDate,
+			"active":          input.Active,
+		}})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar plano de manutenção"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Salvo com sucesso", "id": input.ID})
+}
+
+// --- EXCLUIR PLANO (Admin) ---
+func DeleteMaintenancePlan(c *fiber.Ctx) error {
+	return deleteAdminDocument(c, "maintenance_plans", "Plano não encontrado.")
+}
+
+// --- LISTAR MANUTENÇÕES REALIZADAS ---
+func GetMaintenanceRecords(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if vehicleID, err := primitive.ObjectIDFromHex(c.Query("vehicle_id")); err == nil {
+		filter["vehicle_id"] = vehicleID
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}, {Key: "km", Value: -1}})
+
+	var records []models.MaintenanceRecord
+	cursor, err := Db.Collection("maintenance_records").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar manutenções"})
+	}
+	cursor.All(ctx, &records)
+
+	if records == nil {
+		records = []models.MaintenanceRecord{}
+	}
+	return c.JSON(records)
+}
+
+// --- REGISTRAR MANUTENÇÃO (Admin) ---
+func SaveMaintenanceRecord(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem registrar manutenções."})
+	}
+
+	var input models.MaintenanceRecord
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Dados inválidos"})
+	}
+
+	if input.VehicleID.IsZero() {
+		return c.Status(400).JSON(fiber.Map{"error": "Informe o veículo"})
+	}
+	date, err := parseDate(input.Date)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Data inválida"})
+	}
+	input.Date = date.Format(dateLayout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := Db.Collection("maintenance_records")
+	if input.ID.IsZero() {
+		input.ID = primitive.NewObjectID()
+		input.CreatedAt = time.Now()
+		_, err = collection.InsertOne(ctx, input)
+	} else {
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": input.ID}, bson.M{"$set": bson.M{
+			"vehicle_id": input.VehicleID,
+			"plan_id":    input.PlanID,
+			"date":       input.Date,
+			"km":         input.Km,
+			"cost":       input.Cost,
+			"workshop":   input.Workshop,
+			"notes":      input.Notes,
+		}})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar manutenção"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Salvo com sucesso", "id": input.ID})
+}
+
+// --- EXCLUIR MANUTENÇÃO (Admin) ---
+func DeleteMaintenanceRecord(c *fiber.Ctx) error {
+	return deleteAdminDocument(c, "maintenance_records", "Manutenção não encontrada.")
+}
+
+// --- VEÍCULOS COM MANUTENÇÃO VENCENDO / VENCIDA ---
+// ?all=true traz também os planos em dia
+func GetMaintenanceDue(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	includeAll := c.QueryBool("all", false)
+
+	var plans []models.MaintenancePlan
+	cursor, err := Db.Collection("maintenance_plans").Find(ctx, bson.M{"active": true})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar planos de manutenção"})
+	}
+	cursor.All(ctx, &plans)
+
+	vehicles := map[primitive.ObjectID]models.Vehicle{}
+	odometers := map[primitive.ObjectID]float64{}
+	now := time.Now()
+
+	result := []models.MaintenanceStatus{}
+	for _, plan := range plans {
+		vehicle, ok := vehicles[plan.VehicleID]
+		if !ok {
+			if err := Db.Collection("vehicles").FindOne(ctx, bson.M{"_id": plan.VehicleID}).Decode(&vehicle); err != nil {
+				continue // Veículo removido do cadastro
+			}
+			vehicles[plan.VehicleID] = vehicle
+			odometers[plan.VehicleID], err = latestOdometer(ctx, vehicle)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Erro ao calcular odômetro"})
+			}
+		}
+
+		lastRecord, err := lastMaintenanceRecord(ctx, plan)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar manutenções"})
+		}
+
+		status := computeMaintenanceStatus(plan, lastRecord, odometers[plan.VehicleID], now)
+		status.Vehicle = vehicle
+
+		if includeAll || status.Status != "ok" {
+			result = append(result, status)
+		}
+	}
+
+	return c.JSON(result)
+}
+
+// Maior odômetro conhecido do veículo (viagens e manutenções registradas)
+func latestOdometer(ctx context.Context, vehicle models.Vehicle) (float64, error) {
+	var km float64
+
+	if filter, ok := tripVehicleFilter(vehicle); ok {
+		opts := options.FindOne().SetSort(bson.D{{Key: "km_end", Value: -1}}).SetProjection(bson.M{"km_end": 1})
+		var trip models.Trip
+		err := Db.Collection("trips").FindOne(ctx, filter, opts).Decode(&trip)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return 0, err
+		}
+		km = trip.KmEnd
+	}
+
+	recordOpts := options.FindOne().SetSort(bson.D{{Key: "km", Value: -1}})
+	var record models.MaintenanceRecord
+	err := Db.Collection("maintenance_records").FindOne(ctx, bson.M{"vehicle_id": vehicle.ID}, recordOpts).Decode(&record)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return 0, err
+	}
+
+	return math.Max(km, record.Km), nil
+}
+
+// Última manutenção feita para o plano (nil se nunca foi feita)
+func lastMaintenanceRecord(ctx context.Context, plan models.MaintenancePlan) (*models.MaintenanceRecord, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "date", Value: -1}, {Key: "km", Value: -1}})
+
+	var record models.MaintenanceRecord
+	err := Db.Collection("maintenance_records").FindOne(ctx, bson.M{"plan_id": plan.ID}, opts).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Calcula próximo vencimento (km e/ou data) e a situação do plano
+func computeMaintenanceStatus(plan models.MaintenancePlan, last *models.MaintenanceRecord, currentKm float64, now time.Time) models.MaintenanceStatus {
+	status := models.MaintenanceStatus{
+		Plan:            plan,
+		CurrentKm:       currentKm,
+		LastServiceKm:   plan.StartKm,
+		LastServiceDate: plan.StartDate,
+		Status:          "ok",
+	}
+	if status.LastServiceDate == "" && !plan.CreatedAt.IsZero() {
+		status.LastServiceDate = plan.CreatedAt.Format(dateLayout)
+	}
+	if last != nil {
+		status.LastServiceKm = last.Km
+		status.LastServiceDate = last.Date
+	}
+
+	due, overdue := false, false
+
+	if plan.IntervalKm > 0 {
+		status.NextDueKm = status.LastServiceKm + plan.IntervalKm
+		status.KmRemaining = status.NextDueKm - currentKm
+		overdue = overdue || status.KmRemaining <= 0
+		due = due || status.KmRemaining <= plan.IntervalKm*maintenanceDueKmRatio
+	}
+
+	if plan.IntervalMonths > 0 {
+		if lastDate, err := parseDate(status.LastServiceDate); err == nil {
+			nextDate := lastDate.AddDate(0, plan.IntervalMonths, 0)
+			status.NextDueDate = nextDate.Format(dateLayout)
+
+			today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+			status.DaysRemaining = int(math.Round(nextDate.Sub(today).Hours() / 24))
+			overdue = overdue || status.DaysRemaining < 0
+			due = due || status.DaysRemaining <= maintenanceDueDays
+		}
+	}
+
+	if overdue {
+		status.Status = "overdue"
+	} else if due {
+		status.Status = "due"
+	}
+	return status
+}
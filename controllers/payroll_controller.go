@@ -0,0 +1,395 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Viagens aprovadas do período com diárias/ajudantes ainda não pagos (ou reabertas depois de pagas)
+func payrollTrips(ctx context.Context, c *fiber.Ctx) ([]models.Trip, tripQuery, error) {
+	query := tripQuery{From: c.Query("from"), To: c.Query("to"), Route: c.Query("route"), Driver: c.Query("driver"), Status: "approved"}
+	query.defaultToCurrentMonth(time.Now())
+
+	filter, err := query.filter("", true)
+	if err != nil {
+		return nil, query, err
+	}
+	filter["$or"] = bson.A{
+		bson.M{
+			"payroll_batch": bson.M{"$exists": false},
+			"$or": bson.A{
+				bson.M{"expense_daily": bson.M{"$gt": 0}},
+				bson.M{"expense_assistant": bson.M{"$gt": 0}},
+			},
+		},
+		bson.M{"payroll_correction": true},
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "start_date", Value: 1}})
+	var trips []models.Trip
+	cursor, err := Db.Collection("trips").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, query, err
+	}
+	err = cursor.All(ctx, &trips)
+	return trips, query, err
+}
+
+// Parte de cada pessoa na viagem: diárias do motorista e valor de cada ajudante
+func payrollShares(trip models.Trip) []models.PayrollShare {
+	shares := []models.PayrollShare{}
+	add := func(share models.PayrollShare) {
+		for i := range shares {
+			if shares[i].Key == share.Key {
+				shares[i].Days += share.Days
+				shares[i].Amount += share.Amount
+				return
+			}
+		}
+		shares = append(shares, share)
+	}
+
+	if trip.ExpenseDaily > 0 {
+		share := models.PayrollShare{Key: "driver:" + strings.ToLower(trip.Driver), Kind: "driver", Name: trip.Driver, Amount: trip.ExpenseDaily}
+		if days, err := tripDays(trip); err == nil {
+			share.Days = float64(len(days))
+		}
+		add(share)
+	}
+
+	if trip.ExpenseAssistant > 0 {
+		listed := 0.0
+		for _, a := range trip.Assistants {
+			key := "assistant:" + a.AssistantID.Hex()
+			if a.AssistantID.IsZero() {
+				key = "assistant:" + strings.ToLower(a.Name)
+			}
+			add(models.PayrollShare{Key: key, Kind: "assistant", Name: a.Name, Days: a.Days, Amount: a.Amount})
+			listed += a.Amount
+		}
+
+		// Valor lançado manualmente, sem ajudantes escalados na viagem
+		if rest := trip.ExpenseAssistant - listed; rest > 0.005 {
+			add(models.PayrollShare{Key: "assistant:?", Kind: "assistant", Name: "Ajudantes não identificados", Amount: rest})
+		}
+	}
+
+	for i := range shares {
+		shares[i].Amount = round2(shares[i].Amount)
+	}
+	return shares
+}
+
+// Diferença entre a parte atual de cada pessoa e a já paga em lote anterior
+func payrollCorrectionShares(trip models.Trip) []models.PayrollShare {
+	current := payrollShares(trip)
+	diff := []models.PayrollShare{}
+	paid := map[string]models.PayrollShare{}
+	for _, share := range trip.PayrollExported {
+		paid[share.Key] = share
+	}
+
+	for _, share := range current {
+		share.Days -= paid[share.Key].Days
+		share.Amount = round2(share.Amount - paid[share.Key].Amount)
+		delete(paid, share.Key)
+		diff = append(diff, share)
+	}
+	// Pessoas retiradas da viagem: estorna tudo o que foi pago
+	for _, share := range trip.PayrollExported {
+		if _, dropped := paid[share.Key]; dropped {
+			share.Days, share.Amount = -share.Days, -share.Amount
+			diff = append(diff, share)
+		}
+	}
+
+	result := []models.PayrollShare{}
+	for _, share := range diff {
+		if share.Amount != 0 || math.Abs(share.Days) >= 0.05 {
+			result = append(result, share)
+		}
+	}
+	return result
+}
+
+// Soma diárias por motorista e valores por ajudante. Viagens reabertas depois de pagas
+// entram só com a diferença, em linhas de correção separadas.
+func buildPayrollEntries(ctx context.Context, trips []models.Trip) ([]models.PayrollEntry, error) {
+	var drivers []models.Driver
+	cursor, err := Db.Collection("drivers").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &drivers); err != nil {
+		return nil, err
+	}
+	driverDocs := map[string]string{}
+	for _, d := range drivers {
+		driverDocs[strings.ToLower(d.Name)] = d.Document
+	}
+
+	var assistants []models.Assistant
+	cursor, err = Db.Collection("assistants").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &assistants); err != nil {
+		return nil, err
+	}
+	assistantDocs := map[string]string{}
+	for _, a := range assistants {
+		assistantDocs["assistant:"+a.ID.Hex()] = a.Document
+	}
+
+	entries := map[string]*models.PayrollEntry{}
+	entryFor := func(share models.PayrollShare, correction bool) *models.PayrollEntry {
+		key := share.Key
+		if correction {
+			key = "correction:" + key
+		}
+		e, ok := entries[key]
+		if !ok {
+			document := assistantDocs[share.Key]
+			if share.Kind == "driver" {
+				document = driverDocs[strings.ToLower(share.Name)]
+			}
+			e = &models.PayrollEntry{Kind: share.Kind, Name: share.Name, Document: document, Trips: []string{}, Correction: correction}
+			entries[key] = e
+		}
+		return e
+	}
+
+	for _, trip := range trips {
+		shares := payrollShares(trip)
+		if trip.PayrollCorrection {
+			shares = payrollCorrectionShares(trip)
+		}
+
+		for _, share := range shares {
+			e := entryFor(share, trip.PayrollCorrection)
+			e.Days += share.Days
+			e.Amount += share.Amount
+			e.Trips = append(e.Trips, trip.ID.Hex())
+		}
+	}
+
+	result := []models.PayrollEntry{}
+	for _, e := range entries {
+		e.Amount = round2(e.Amount)
+		e.Days = math.Round(e.Days*10) / 10
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Correction != result[j].Correction {
+			return !result[i].Correction
+		}
+		if result[i].Kind != result[j].Kind {
+			return result[i].Kind == "driver"
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func payrollCSV(entries []models.PayrollEntry, sep rune) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("\xef\xbb\xbf")
+
+	writer := csv.NewWriter(&buf)
+	writer.Comma = sep
+	writer.Write([]string{"Tipo", "Nome", "CPF", "Dias", "Valor", "Viagens"})
+
+	total := 0.0
+	for _, e := range entries {
+		kind := "Diária motorista"
+		if e.Kind == "assistant" {
+			kind = "Ajudante"
+		}
+		if e.Correction {
+			kind = "Correção - " + kind
+		}
+		writer.Write([]string{kind, e.Name, e.Document, formatNumberBR(e.Days, 1), formatNumberBR(e.Amount, 2), strings.Join(e.Trips, " ")})
+		total += e.Amount
+	}
+	writer.Write([]string{"", "TOTAL", "", "", formatNumberBR(total, 2), ""})
+
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+func sendPayrollCSV(c *fiber.Ctx, entries []models.PayrollEntry, name string) error {
+	data, err := payrollCSV(entries, csvSeparator(c.Query("sep")))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao gerar arquivo"})
+	}
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", name))
+	c.Set("Content-Type", "text/csv; charset=utf-8")
+	return c.Send(data)
+}
+
+// --- PRÉVIA DA FOLHA (Admin) ---
+// GET ?from=&to=&route=&driver=&format=json|csv. Não marca as viagens.
+func PreviewPayroll(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	trips, query, err := payrollTrips(ctx, c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Erro ao buscar viagens do período"})
+	}
+
+	entries, err := buildPayrollEntries(ctx, trips)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao calcular folha"})
+	}
+
+	if c.Query("format") == "csv" {
+		return sendPayrollCSV(c, entries, "folha_previa_"+query.From)
+	}
+	return c.JSON(fiber.Map{"from": query.From, "to": query.To, "trips": len(trips), "entries": entries})
+}
+
+// --- EXPORTAR FOLHA E BLOQUEAR VIAGENS (Admin) ---
+// POST ?from=&to=&route=&driver=. As viagens do lote não entram em exportações futuras;
+// reabertas e aprovadas de novo, entram só com a diferença.
+func ExportPayroll(c *fiber.Ctx) error {
+	username, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	trips, query, err := payrollTrips(ctx, c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Erro ao buscar viagens do período"})
+	}
+	if len(trips) == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Nenhuma diária ou ajudante pendente de pagamento no período"})
+	}
+
+	entries, err := buildPayrollEntries(ctx, trips)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao calcular folha"})
+	}
+
+	batch := models.PayrollBatch{
+		ID:        primitive.NewObjectID(),
+		From:      query.From,
+		To:        query.To,
+		Entries:   entries,
+		CreatedBy: username,
+		CreatedAt: time.Now(),
+	}
+	var marks []exportMark
+	for _, trip := range trips {
+		marks = append(marks, exportMark{TripID: trip.ID, Exported: payrollShares(trip), Correction: trip.PayrollCorrection})
+		batch.TripIDs = append(batch.TripIDs, trip.ID.Hex())
+	}
+	for _, e := range entries {
+		batch.Total += e.Amount
+	}
+	batch.Total = round2(batch.Total)
+
+	// Só marca viagens ainda livres ou correções pendentes (evita pagar duas vezes se dois admins exportarem juntos)
+	err = payrollExport.register(ctx, batch.ID, batch, marks, batch.CreatedAt, false)
+	if errors.Is(err, errExportConflict) {
+		return c.Status(409).JSON(fiber.Map{"error": "Viagens exportadas por outro usuário ao mesmo tempo. Tente novamente."})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao registrar lote"})
+	}
+
+	return sendPayrollCSV(c, entries, "folha_"+batch.ID.Hex())
+}
+
+// --- LOTES DA FOLHA (Admin) ---
+func GetPayrollBatches(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var batches []models.PayrollBatch
+	cursor, err := Db.Collection("payroll_batches").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar lotes"})
+	}
+	cursor.All(ctx, &batches)
+
+	if batches == nil {
+		batches = []models.PayrollBatch{}
+	}
+	return c.JSON(batches)
+}
+
+// Baixa novamente o CSV de um lote já exportado
+func DownloadPayrollBatch(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+	}
+
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var batch models.PayrollBatch
+	if err := Db.Collection("payroll_batches").FindOne(ctx, bson.M{"_id": objID}).Decode(&batch); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Lote não encontrado."})
+	}
+	return sendPayrollCSV(c, batch.Entries, "folha_"+batch.ID.Hex())
+}
+
+// Cancela o lote: as viagens voltam a ficar pendentes de pagamento
+func DeletePayrollBatch(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+	}
+
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	found, err := payrollExport.release(ctx, objID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao liberar viagens do lote"})
+	}
+	if !found {
+		return c.Status(404).JSON(fiber.Map{"error": "Lote não encontrado."})
+	}
+
+	return c.JSON(fiber.Map{"message": "Lote cancelado. As viagens poderão ser exportadas novamente."})
+}
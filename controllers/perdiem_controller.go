@@ -0,0 +1,386 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Limite de segurança para datas digitadas erradas (Ex: ano trocado)
+const maxTripDays = 366
+
+// Dias corridos da viagem, de StartDate até EndDate (inclusive)
+func tripDays(trip models.Trip) ([]time.Time, error) {
+	start, err := parseDate(trip.StartDate)
+	if err != nil {
+		return nil, err
+	}
+	end := start
+	if trip.EndDate != "" {
+		if end, err = parseDate(trip.EndDate); err != nil {
+			return nil, err
+		}
+	}
+
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+	end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.Local)
+	if end.Before(start) {
+		return nil, errors.New("Data de retorno anterior à saída")
+	}
+
+	var days []time.Time
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+		if len(days) > maxTripDays {
+			return nil, errors.New("Período da viagem muito longo")
+		}
+	}
+	return days, nil
+}
+
+func factorOrFull(value float64) float64 {
+	if value <= 0 {
+		return 1
+	}
+	return value
+}
+
+// Escolhe a regra mais específica: rota > região > padrão
+func matchPerDiemRule(ctx context.Context, trip models.Trip) (*models.PerDiemRule, error) {
+	var rules []models.PerDiemRule
+	cursor, err := Db.Collection("per_diem_rules").Find(ctx, bson.M{"active": true})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+
+	region := ""
+	var route models.Route
+	if err := Db.Collection("routes").FindOne(ctx, bson.M{"name": trip.Route}).Decode(&route); err == nil {
+		region = route.Region
+	}
+
+	var byRegion, fallback *models.PerDiemRule
+	for i := range rules {
+		rule := &rules[i]
+		switch {
+		case rule.Route != "" && strings.EqualFold(rule.Route, trip.Route):
+			return rule, nil
+		case rule.Route == "" && rule.Region != "" && region != "" && strings.EqualFold(rule.Region, region):
+			byRegion = rule
+		case rule.Route == "" && rule.Region == "":
+			fallback = rule
+		}
+	}
+	if byRegion != nil {
+		return byRegion, nil
+	}
+	return fallback, nil
+}
+
+// Feriados cadastrados no período da viagem
+func holidaysBetween(ctx context.Context, days []time.Time) (map[string]string, error) {
+	holidays := map[string]string{}
+	if len(days) == 0 {
+		return holidays, nil
+	}
+
+	filter := bson.M{"date": bson.M{
+		"$gte": days[0].Format(dateLayout),
+		"$lte": days[len(days)-1].Format(dateLayout),
+	}}
+	var list []models.Holiday
+	cursor, err := Db.Collection("holidays").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	for _, h := range list {
+		holidays[h.Date] = h.Name
+	}
+	return holidays, nil
+}
+
+// Calcula a diária esperada da viagem com a regra informada
+func computePerDiem(trip models.Trip, rule models.PerDiemRule, days []time.Time, holidays map[string]string) models.PerDiemCalculation {
+	calc := models.PerDiemCalculation{
+		RuleID:   rule.ID.Hex(),
+		RuleName: rule.Name,
+		Days:     []models.PerDiemDay{},
+		Declared: trip.ExpenseDaily,
+	}
+
+	departure := factorOrFull(rule.DepartureFactor)
+	arrival := factorOrFull(rule.ReturnFactor)
+
+	for i, day := range days {
+		entry := models.PerDiemDay{Date: day.Format(dateLayout), Factor: 1, Multiplier: 1}
+
+		switch {
+		case len(days) == 1:
+			entry.Factor = math.Min(1, departure+arrival)
+			entry.Note = "saída e retorno no mesmo dia"
+		case i == 0:
+			entry.Factor = departure
+			entry.Note = "saída"
+		case i == len(days)-1:
+			entry.Factor = arrival
+			entry.Note = "retorno"
+		}
+
+		if name, ok := holidays[entry.Date]; ok {
+			entry.Multiplier = factorOrFull(rule.HolidayMultiplier)
+			entry.Note = strings.TrimSpace(entry.Note + " feriado: " + name)
+		} else if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			entry.Multiplier = factorOrFull(rule.WeekendMultiplier)
+			entry.Note = strings.TrimSpace(entry.Note + " fim de semana")
+		}
+
+		// Teto de dias: o último dia pode entrar parcialmente
+		if rule.MaxDays > 0 && calc.TotalDays+entry.Factor > rule.MaxDays {
+			entry.Factor = math.Max(0, rule.MaxDays-calc.TotalDays)
+			calc.Capped = true
+		}
+
+		entry.Amount = math.Round(rule.DailyRate*entry.Factor*entry.Multiplier*100) / 100
+		calc.TotalDays += entry.Factor
+		calc.Expected += entry.Amount
+		calc.Days = append(calc.Days, entry)
+	}
+
+	if rule.MaxAmount > 0 && calc.Expected > rule.MaxAmount {
+		calc.Expected = rule.MaxAmount
+		calc.Capped = true
+	}
+
+	calc.Expected = math.Round(calc.Expected*100) / 100
+	calc.Difference = math.Round((calc.Declared-calc.Expected)*100) / 100
+	return calc
+}
+
+// Busca regra e feriados e calcula a diária da viagem (nil se nenhuma regra se aplica)
+func perDiemForTrip(ctx context.Context, trip models.Trip) (*models.PerDiemCalculation, *models.PerDiemRule, error) {
+	rule, err := matchPerDiemRule(ctx, trip)
+	if err != nil || rule == nil {
+		return nil, nil, err
+	}
+
+	days, err := tripDays(trip)
+	if err != nil {
+		return nil, rule, err
+	}
+
+	holidays, err := holidaysBetween(ctx, days)
+	if err != nil {
+		return nil, rule, err
+	}
+
+	calc := computePerDiem(trip, *rule, days, holidays)
+	return &calc, rule, nil
+}
+
+// Preenche ExpenseDaily na criação quando a regra pede e o valor não foi informado
+func applyPerDiemAutoFill(ctx context.Context, trip *models.Trip) {
+	if trip.ExpenseDaily > 0 {
+		return
+	}
+	calc, rule, err := perDiemForTrip(ctx, *trip)
+	if err != nil || calc == nil || !rule.AutoFill {
+		return
+	}
+	trip.ExpenseDaily = calc.Expected
+}
+
+// --- REGRAS DE DIÁRIA ---
+func GetPerDiemRules(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+
+	var rules []models.PerDiemRule
+	cursor, err := Db.Collection("per_diem_rules").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar regras de diária"})
+	}
+	cursor.All(ctx, &rules)
+
+	if rules == nil {
+		rules = []models.PerDiemRule{}
+	}
+	return c.JSON(rules)
+}
+
+func SavePerDiemRule(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem alterar regras de diária."})
+	}
+
+	var input models.PerDiemRule
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Dados inválidos"})
+	}
+	if input.DailyRate <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Informe o valor da diária"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var err error
+	if input.ID.IsZero() {
+		input.ID = primitive.NewObjectID()
+		_, err = Db.Collection("per_diem_rules").InsertOne(ctx, input)
+	} else {
+		_, err = Db.Collection("per_diem_rules").UpdateOne(ctx, bson.M{"_id": input.ID}, bson.M{"$set": input})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar regra de diária"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Salvo com sucesso", "id": input.ID})
+}
+
+func DeletePerDiemRule(c *fiber.Ctx) error {
+	return deleteAdminDocument(c, "per_diem_rules", "Regra não encontrada.")
+}
+
+// --- FERIADOS ---
+func GetHolidays(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: 1}})
+
+	var holidays []models.Holiday
+	cursor, err := Db.Collection("holidays").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar feriados"})
+	}
+	cursor.All(ctx, &holidays)
+
+	if holidays == nil {
+		holidays = []models.Holiday{}
+	}
+	return c.JSON(holidays)
+}
+
+func SaveHoliday(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem alterar feriados."})
+	}
+
+	var input models.Holiday
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Dados inválidos"})
+	}
+	date, err := parseDate(input.Date)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Data inválida"})
+	}
+	input.Date = date.Format(dateLayout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if input.ID.IsZero() {
+		input.ID = primitive.NewObjectID()
+		_, err = Db.Collection("holidays").InsertOne(ctx, input)
+	} else {
+		_, err = Db.Collection("holidays").UpdateOne(ctx, bson.M{"_id": input.ID}, bson.M{"$set": input})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar feriado"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Salvo com sucesso", "id": input.ID})
+}
+
+func DeleteHoliday(c *fiber.Ctx) error {
+	return deleteAdminDocument(c, "holidays", "Feriado não encontrado.")
+}
+
+// --- DIÁRIA ESPERADA x DECLARADA DE UMA VIAGEM ---
+func GetTripPerDiem(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	username, isAdmin := getUserFromToken(c)
+
+	var trip models.Trip
+	if err := Db.Collection("trips").FindOne(ctx, bson.M{"_id": objID}).Decode(&trip); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Viagem não encontrada"})
+	}
+	if !isAdmin && trip.UserID != username {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso negado a este registro."})
+	}
+
+	calc, _, err := perDiemForTrip(ctx, trip)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Não foi possível calcular a diária: " + err.Error()})
+	}
+	if calc == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Nenhuma regra de diária se aplica a esta viagem"})
+	}
+
+	return c.JSON(calc)
+}
+
+// --- PREENCHER ExpenseDaily COM O VALOR CALCULADO ---
+func ApplyTripPerDiem(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	username, isAdmin := getUserFromToken(c)
+
+	var trip models.Trip
+	if err := Db.Collection("trips").FindOne(ctx, bson.M{"_id": objID}).Decode(&trip); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Viagem não encontrada"})
+	}
+	if !isAdmin && trip.UserID != username {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso negado a este registro."})
+	}
+	if trip.Approved {
+		return c.Status(403).JSON(fiber.Map{"error": "Viagem já aprovada/fechada. Edição bloqueada."})
+	}
+
+	calc, _, err := perDiemForTrip(ctx, trip)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Não foi possível calcular a diária: " + err.Error()})
+	}
+	if calc == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Nenhuma regra de diária se aplica a esta viagem"})
+	}
+
+	_, err = Db.Collection("trips").UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": bson.M{"expense_daily": calc.Expected}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao atualizar"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Diária atualizada com sucesso!", "expense_daily": calc.Expected})
+}
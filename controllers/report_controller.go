@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Soma das despesas de um documento de viagem (expressão de agregação)
+var expenseTotalExpr = bson.M{"$add": bson.A{"$expense_fuel", "$expense_daily", "$expense_assistant", "$expense_toll", "$expense_other"}}
+
+// Campos somados em cada agrupamento do fechamento
+func closingGroupStage(key interface{}) bson.M {
+	return bson.M{"$group": bson.M{
+		"_id":               key,
+		"trips":             bson.M{"$sum": 1},
+		"km_driven":         bson.M{"$sum": bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{"$km_end", "$km_start"}}}}},
+		"value_withdraw":    bson.M{"$sum": "$value_withdraw"},
+		"value_received":    bson.M{"$sum": "$value_received"},
+		"expense_fuel":      bson.M{"$sum": "$expense_fuel"},
+		"expense_daily":     bson.M{"$sum": "$expense_daily"},
+		"expense_assistant": bson.M{"$sum": "$expense_assistant"},
+		"expense_toll":      bson.M{"$sum": "$expense_toll"},
+		"expense_other":     bson.M{"$sum": "$expense_other"},
+		"expense_total":     bson.M{"$sum": expenseTotalExpr},
+		"balance":           bson.M{"$sum": bson.M{"$subtract": bson.A{bson.M{"$add": bson.A{"$value_withdraw", "$value_received"}}, expenseTotalExpr}}},
+	}}
+}
+
+func closingFacet(key string) bson.A {
+	return bson.A{closingGroupStage("$" + key), bson.M{"$sort": bson.M{"_id": 1}}}
+}
+
+// Monta o fechamento do período com uma única agregação ($facet)
+func buildClosingReport(ctx context.Context, filter bson.M) (models.ClosingReport, error) {
+	// Documentos antigos podem não ter algum campo numérico
+	defaults := bson.M{}
+	for _, field := range []string{"km_start", "km_end", "value_withdraw", "value_received", "expense_fuel", "expense_daily", "expense_assistant", "expense_toll", "expense_other"} {
+		defaults[field] = bson.M{"$ifNull": bson.A{"$" + field, 0}}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$set", Value: defaults}},
+		{{Key: "$facet", Value: bson.M{
+			"by_route":   closingFacet("route"),
+			"by_driver":  closingFacet("driver"),
+			"by_vehicle": closingFacet("vehicle"),
+			"by_user":    closingFacet("user_id"),
+			"totals":     bson.A{closingGroupStage(nil)},
+		}}},
+	}
+
+	var report models.ClosingReport
+	cursor, err := Db.Collection("trips").Aggregate(ctx, pipeline)
+	if err != nil {
+		return report, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		models.ClosingReport `bson:",inline"`
+		Totals               []models.ReportTotals `bson:"totals"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return report, err
+	}
+
+	if len(results) > 0 {
+		report = results[0].ClosingReport
+		if len(results[0].Totals) > 0 {
+			report.Totals = results[0].Totals[0]
+		}
+	}
+	for _, list := range []*[]models.ReportTotals{&report.ByRoute, &report.ByDriver, &report.ByVehicle, &report.ByUser} {
+		if *list == nil {
+			*list = []models.ReportTotals{}
+		}
+	}
+	report.Totals.Key = "total"
+	return report, nil
+}
+
+// --- RELATÓRIO DE FECHAMENTO DO PERÍODO ---
+// ?from=&to= (padrão: mês corrente), ?status=approved|open e demais filtros de viagem.
+// Usuário comum vê apenas as próprias viagens.
+func GetClosingReport(c *fiber.Ctx) error {
+	username, isAdmin := getUserFromToken(c)
+	if username == "" && !isAdmin {
+		return c.Status(401).JSON(fiber.Map{"error": "Usuário não identificado"})
+	}
+
+	query := tripQueryFromCtx(c)
+	query.defaultToCurrentMonth(time.Now())
+
+	filter, err := query.filter(username, isAdmin)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Período inválido"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report, err := buildClosingReport(ctx, filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao gerar relatório"})
+	}
+	report.From = query.From
+	report.To = query.To
+
+	return c.JSON(report)
+}
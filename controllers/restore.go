@@ -0,0 +1,685 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A restauração grava em coleções de preparo e só troca pelas reais no fim.
+// Os dados anteriores ficam em rollback_<coleção> até a próxima restauração.
+const (
+	stagingPrefix  = "restore_staging_"
+	rollbackPrefix = "rollback_"
+	swapPrefix     = "restore_swap_"
+)
+
+// Modos de restauração
+const (
+	restoreReplace = "replace" // Substitui as coleções inteiras (com ponto de reversão)
+	restoreMerge   = "merge"   // Grava por _id sem apagar os dados atuais
+)
+
+// Resultado da restauração
+type restoreSummary struct {
+	FormatVersion int            `json:"format_version"`
+	SchemaVersion int            `json:"schema_version"`
+	Migrations    []string       `json:"migrations,omitempty"` // Aplicadas aos documentos do arquivo
+	Timestamp     time.Time      `json:"timestamp"`
+	Signed        bool           `json:"signed"` // Assinatura conferida (aceito sem ela só com allow_unsigned)
+	Mode          string         `json:"mode"`
+	Collections   map[string]int `json:"collections"`
+	Skipped       []string       `json:"skipped,omitempty"`
+	Indexes       map[string]int `json:"indexes,omitempty"`  // Índices recriados por coleção
+	Inserted      map[string]int `json:"inserted,omitempty"` // Só no modo merge
+	Updated       map[string]int `json:"updated,omitempty"`
+
+	meta map[string]collectionMeta
+}
+
+type restoreOptions struct {
+	BatchSize int
+	User      string
+
+	Security backupSecurity // Senha e aceite de arquivos sem assinatura
+	Progress progressFunc
+
+	Mode        string    // replace (padrão) ou merge
+	Collections []string  // Vazio: todas as coleções do arquivo
+	From, To    time.Time // Só viagens com start_date no período
+	DocID       string    // Só o documento com este _id
+}
+
+func (o restoreOptions) report(phase, collection string, done int) {
+	if o.Progress != nil {
+		o.Progress(phase, collection, done)
+	}
+}
+
+// Filtro por período ou documento nunca pode apagar o resto da coleção
+func (o restoreOptions) selective() bool {
+	return !o.From.IsZero() || !o.To.IsZero() || o.DocID != ""
+}
+
+func (o restoreOptions) merge() bool {
+	return o.Mode == restoreMerge || o.selective()
+}
+
+func (o restoreOptions) wantsCollection(name string) bool {
+	if len(o.Collections) == 0 {
+		// Só o período informado: restaura apenas viagens
+		if !o.From.IsZero() || !o.To.IsZero() {
+			return name == "trips"
+		}
+		return true
+	}
+	for _, c := range o.Collections {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (o restoreOptions) wantsDoc(collection string, doc bson.Raw) bool {
+	if o.DocID != "" {
+		id := doc.Lookup("_id")
+		if oid, ok := id.ObjectIDOK(); ok {
+			if oid.Hex() != o.DocID {
+				return false
+			}
+		} else if str, ok := id.StringValueOK(); !ok || str != o.DocID {
+			return false
+		}
+	}
+	if collection == "trips" {
+		date, _ := doc.Lookup("start_date").StringValueOK()
+		if !o.From.IsZero() && date < o.From.Format(dateLayout) {
+			return false
+		}
+		if !o.To.IsZero() && date >= o.To.AddDate(0, 0, 1).Format(dateLayout) {
+			return false
+		}
+	}
+	return true
+}
+
+// Dados anteriores guardados pela última restauração (documento único em restore_snapshots)
+type restoreSnapshot struct {
+	ID              string     `json:"-" bson:"_id"`
+	Collections     []string   `json:"collections" bson:"collections"`
+	Missing         []string   `json:"missing,omitempty" bson:"missing,omitempty"` // Não existiam antes da restauração
+	Status          string     `json:"status" bson:"status"`                       // "swapping" durante a troca, "done" depois
+	BackupTimestamp time.Time  `json:"backup_timestamp" bson:"backup_timestamp"`
+	RestoredBy      string     `json:"restored_by" bson:"restored_by"`
+	RestoredAt      time.Time  `json:"restored_at" bson:"restored_at"`
+	RolledBackBy    string     `json:"rolled_back_by,omitempty" bson:"rolled_back_by,omitempty"`
+	RolledBackAt    *time.Time `json:"rolled_back_at,omitempty" bson:"rolled_back_at,omitempty"`
+}
+
+const restoreSnapshotID = "latest"
+
+// Uma restauração (ou reversão) por vez
+var restoreMu sync.Mutex
+
+var errRestoreRunning = errors.New("já existe uma restauração em andamento")
+
+// Cada documento precisa ser lido pelo modelo da coleção
+var restoreValidators = map[string]func(bson.Raw) error{
+	"users": func(raw bson.Raw) error {
+		var u models.User
+		if err := bson.Unmarshal(raw, &u); err != nil {
+			return err
+		}
+		if u.Username == "" {
+			return errors.New("usuário sem username")
+		}
+		return nil
+	},
+	"trips":               modelValidator[models.Trip](),
+	"drivers":             modelValidator[models.Driver](),
+	"vehicles":            modelValidator[models.Vehicle](),
+	"routes":              modelValidator[models.Route](),
+	"assistants":          modelValidator[models.Assistant](),
+	"maintenance_plans":   modelValidator[models.MaintenancePlan](),
+	"maintenance_records": modelValidator[models.MaintenanceRecord](),
+	"settlements":         modelValidator[models.Settlement](),
+	"per_diem_rules":      modelValidator[models.PerDiemRule](),
+	"holidays":            modelValidator[models.Holiday](),
+	"budgets":             modelValidator[models.Budget](),
+	"account_mappings":    modelValidator[models.AccountMapping](),
+	"accounting_batches":  modelValidator[models.AccountingBatch](),
+	"payroll_batches":     modelValidator[models.PayrollBatch](),
+	"report_schedules":    modelValidator[models.ReportSchedule](),
+	"report_runs":         modelValidator[models.ReportRun](),
+}
+
+func modelValidator[T any]() func(bson.Raw) error {
+	return func(raw bson.Raw) error {
+		var v T
+		return bson.Unmarshal(raw, &v)
+	}
+}
+
+func validateRestoreDoc(collection string, raw bson.Raw) error {
+	if _, err := raw.LookupErr("_id"); err != nil {
+		return errors.New("documento sem _id")
+	}
+	if validate, ok := restoreValidators[collection]; ok {
+		return validate(raw)
+	}
+	return nil
+}
+
+// renameCollection é comando do banco admin
+func renameCollection(ctx context.Context, from, to string, dropTarget bool) error {
+	cmd := bson.D{
+		{Key: "renameCollection", Value: Db.Name() + "." + from},
+		{Key: "to", Value: Db.Name() + "." + to},
+		{Key: "dropTarget", Value: dropTarget},
+	}
+	return Db.Client().Database("admin").RunCommand(ctx, cmd).Err()
+}
+
+func isNamespaceNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 26
+}
+
+func collectionExists(ctx context.Context, name string) (bool, error) {
+	names, err := Db.ListCollectionNames(ctx, bson.M{"name": name})
+	return len(names) > 0, err
+}
+
+func dropStaging(collections []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for _, name := range collections {
+		Db.Collection(stagingPrefix + name).Drop(ctx)
+	}
+}
+
+// Lê o backup para as coleções de preparo, em lotes, validando cada documento
+func stageBackup(ctx context.Context, r io.Reader, opts restoreOptions) (restoreSummary, []string, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = restoreBatchSize
+	}
+
+	reader, err := newBackupReader(r, opts.Security)
+	if err != nil {
+		return restoreSummary{}, nil, err
+	}
+
+	summary := restoreSummary{
+		FormatVersion: reader.Header.FormatVersion,
+		SchemaVersion: reader.Header.SchemaVersion,
+		Migrations:    migrationDescriptions(reader.Migrations),
+		Timestamp:     reader.Header.Timestamp,
+		Mode:          restoreReplace,
+		Collections:   map[string]int{},
+		Indexes:       map[string]int{},
+		meta:          map[string]collectionMeta{},
+	}
+	if opts.merge() {
+		summary.Mode = restoreMerge
+	}
+	var staged []string
+
+	var current string
+	var currentMeta collectionMeta
+	currentStaged := false
+	batch := make([]interface{}, 0, opts.BatchSize)
+	batchBytes := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if _, err := Db.Collection(stagingPrefix+current).InsertMany(ctx, batch); err != nil {
+			return fmt.Errorf("erro ao inserir dados em %s: %w", current, err)
+		}
+		summary.Collections[current] += len(batch)
+		batch = batch[:0]
+		batchBytes = 0
+		opts.report("staging", current, summary.Collections[current])
+		return nil
+	}
+
+	// Coleção de preparo já com as opções originais
+	stage := func() error {
+		Db.Collection(stagingPrefix + current).Drop(ctx)
+		if err := createCollectionWithOptions(ctx, stagingPrefix+current, currentMeta.Options); err != nil {
+			return fmt.Errorf("erro ao preparar %s: %w", current, err)
+		}
+		staged = append(staged, current)
+		currentStaged = true
+		return nil
+	}
+
+	// Índices criados depois dos dados (mais rápido); índice único violado cancela a restauração
+	finish := func() error {
+		if err := flush(); err != nil {
+			return err
+		}
+		if current == "" || !currentStaged {
+			return nil
+		}
+		indexes := summary.meta[current].Indexes
+		if err := createIndexes(ctx, stagingPrefix+current, indexes, false); err != nil {
+			return fmt.Errorf("%s: erro ao recriar %w", current, err)
+		}
+		summary.Indexes[current] = len(indexes)
+		return nil
+	}
+
+	for {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return summary, staged, err
+		}
+
+		if entry.Doc == nil {
+			if err := finish(); err != nil {
+				return summary, staged, err
+			}
+			current = ""
+			// Pular coleções desconhecidas por segurança
+			if !isBackupCollection(entry.Collection) {
+				summary.Skipped = append(summary.Skipped, entry.Collection)
+				continue
+			}
+			if !opts.wantsCollection(entry.Collection) {
+				continue
+			}
+			if _, dup := summary.Collections[entry.Collection]; dup {
+				return summary, staged, fmt.Errorf("coleção %s repetida no arquivo", entry.Collection)
+			}
+			current = entry.Collection
+			currentMeta = entry.Meta
+			currentStaged = false
+			summary.Collections[current] = 0
+			summary.meta[current] = entry.Meta
+
+			// Na troca a coleção é criada mesmo vazia (substitui a atual). No merge só
+			// quando aparece um documento pedido: um ?id= não prepara o banco inteiro.
+			if !opts.merge() {
+				if err := stage(); err != nil {
+					return summary, staged, err
+				}
+			}
+			continue
+		}
+
+		if current == "" || !opts.wantsDoc(current, entry.Doc) {
+			continue
+		}
+		if !currentStaged {
+			if err := stage(); err != nil {
+				return summary, staged, err
+			}
+		}
+		if err := validateRestoreDoc(current, entry.Doc); err != nil {
+			return summary, staged, fmt.Errorf("%s: documento %d inválido: %w", current, summary.Collections[current]+len(batch)+1, err)
+		}
+		batch = append(batch, entry.Doc)
+		batchBytes += len(entry.Doc)
+		// Pedaços do GridFS são grandes: limita o lote também pelo tamanho
+		if len(batch) >= opts.BatchSize || batchBytes >= restoreBatchBytes {
+			if err := flush(); err != nil {
+				return summary, staged, err
+			}
+		}
+	}
+	if err := finish(); err != nil {
+		return summary, staged, err
+	}
+	summary.Signed = reader.Signed
+
+	return summary, staged, validateStaging(ctx, summary, opts)
+}
+
+// Confere o preparo antes da troca
+func validateStaging(ctx context.Context, summary restoreSummary, opts restoreOptions) error {
+	if len(summary.Collections) == 0 {
+		return errors.New("nenhuma coleção conhecida no arquivo")
+	}
+	for _, name := range opts.Collections {
+		if _, ok := summary.Collections[name]; !ok {
+			return fmt.Errorf("a coleção %s não está no backup", name)
+		}
+	}
+	if opts.DocID != "" {
+		total := 0
+		for _, count := range summary.Collections {
+			total += count
+		}
+		if total == 0 {
+			return fmt.Errorf("documento %s não encontrado no backup", opts.DocID)
+		}
+	}
+	for name, expected := range summary.Collections {
+		count, err := Db.Collection(stagingPrefix+name).CountDocuments(ctx, bson.M{})
+		if err != nil {
+			return err
+		}
+		if int(count) != expected {
+			return fmt.Errorf("%s: %d documentos gravados, %d esperados", name, count, expected)
+		}
+	}
+
+	// Não deixar o sistema sem administrador (no merge os atuais continuam)
+	if _, ok := summary.Collections["users"]; ok && !opts.merge() {
+		admins, err := Db.Collection(stagingPrefix+"users").CountDocuments(ctx, bson.M{"is_admin": true})
+		if err != nil {
+			return err
+		}
+		if admins == 0 {
+			return errors.New("o backup não tem nenhum usuário administrador")
+		}
+	}
+	return nil
+}
+
+// Troca as coleções de preparo pelas reais, guardando as atuais em rollback_.
+// Se uma troca falhar, as já feitas são desfeitas.
+func swapStaging(ctx context.Context, collections []string) (missing []string, err error) {
+	var done []string
+	undo := func() { unswapStaging(ctx, done) }
+
+	for _, name := range collections {
+		exists, err := collectionExists(ctx, name)
+		if err != nil {
+			undo()
+			return nil, err
+		}
+		if exists {
+			if err := renameCollection(ctx, name, rollbackPrefix+name, true); err != nil {
+				undo()
+				return nil, fmt.Errorf("erro ao guardar %s: %w", name, err)
+			}
+		} else {
+			Db.Collection(rollbackPrefix + name).Drop(ctx)
+			missing = append(missing, name)
+		}
+		if err := renameCollection(ctx, stagingPrefix+name, name, false); err != nil {
+			if exists {
+				renameCollection(ctx, rollbackPrefix+name, name, false)
+			}
+			undo()
+			return nil, fmt.Errorf("erro ao ativar %s: %w", name, err)
+		}
+		done = append(done, name)
+	}
+	return missing, nil
+}
+
+// Desfaz a troca: as coleções restauradas voltam ao preparo e as guardadas voltam a valer
+func unswapStaging(ctx context.Context, collections []string) {
+	for _, name := range collections {
+		renameCollection(ctx, name, stagingPrefix+name, true)
+		if err := renameCollection(ctx, rollbackPrefix+name, name, false); err != nil && !isNamespaceNotFound(err) {
+			log.Printf("❌ Erro ao desfazer troca de %s: %v", name, err)
+		}
+	}
+}
+
+// Grava os documentos preparados nas coleções reais por _id, sem apagar nada.
+// Não é atômico entre lotes, mas repetir a mesma restauração é seguro.
+func mergeStaging(ctx context.Context, collections []string, summary *restoreSummary, opts restoreOptions) error {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = restoreBatchSize
+	}
+	summary.Inserted = map[string]int{}
+	summary.Updated = map[string]int{}
+
+	for _, name := range collections {
+		// Nada a gravar: a coleção real fica intocada
+		if summary.Collections[name] == 0 {
+			continue
+		}
+
+		// Coleção nova ganha as opções do backup; índices faltantes são criados
+		// e os existentes com outra definição ficam como estão
+		meta := summary.meta[name]
+		exists, err := collectionExists(ctx, name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := createCollectionWithOptions(ctx, name, meta.Options); err != nil {
+				return fmt.Errorf("erro ao criar %s: %w", name, err)
+			}
+		}
+		if err := createIndexes(ctx, name, meta.Indexes, true); err != nil {
+			return fmt.Errorf("%s: erro ao recriar %w", name, err)
+		}
+
+		cursor, err := Db.Collection(stagingPrefix+name).Find(ctx, bson.M{}, options.Find().SetBatchSize(int32(batchSize)))
+		if err != nil {
+			return err
+		}
+
+		writes := make([]mongo.WriteModel, 0, batchSize)
+		writesBytes := 0
+		done := 0
+		write := func() error {
+			if len(writes) == 0 {
+				return nil
+			}
+			res, err := Db.Collection(name).BulkWrite(ctx, writes)
+			if err != nil {
+				return fmt.Errorf("erro ao gravar %s: %w", name, err)
+			}
+			summary.Inserted[name] += int(res.UpsertedCount)
+			summary.Updated[name] += int(res.ModifiedCount)
+			done += len(writes)
+			opts.report("merge", name, done)
+			writes = writes[:0]
+			writesBytes = 0
+			return nil
+		}
+
+		for cursor.Next(ctx) {
+			doc := append(bson.Raw(nil), cursor.Current...)
+			writes = append(writes, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": doc.Lookup("_id")}).
+				SetReplacement(doc).
+				SetUpsert(true))
+			writesBytes += len(doc)
+			if len(writes) >= batchSize || writesBytes >= restoreBatchBytes {
+				if err := write(); err != nil {
+					cursor.Close(ctx)
+					return err
+				}
+			}
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return err
+		}
+		if err := write(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restaura o backup: preparo + validação + troca atômica por coleção.
+// No modo merge os documentos preparados são gravados por _id e não há troca.
+func restoreFromReader(ctx context.Context, r io.Reader, opts restoreOptions) (restoreSummary, error) {
+	if !restoreMu.TryLock() {
+		return restoreSummary{}, errRestoreRunning
+	}
+	defer restoreMu.Unlock()
+
+	summary, staged, err := stageBackup(ctx, r, opts)
+	if err != nil {
+		dropStaging(staged)
+		return summary, err
+	}
+
+	if opts.merge() {
+		err := mergeStaging(ctx, staged, &summary, opts)
+		dropStaging(staged)
+		return summary, err
+	}
+
+	// O ponto de reversão é gravado antes da troca: se o processo cair no meio,
+	// o registro "swapping" diz quais coleções foram trocadas
+	snapshots := Db.Collection("restore_snapshots")
+	previous, err := snapshots.FindOne(ctx, bson.M{"_id": restoreSnapshotID}).Raw()
+	if err != nil && err != mongo.ErrNoDocuments {
+		dropStaging(staged)
+		return summary, err
+	}
+	snapshot := restoreSnapshot{
+		ID:              restoreSnapshotID,
+		Collections:     staged,
+		BackupTimestamp: summary.Timestamp,
+		RestoredBy:      opts.User,
+		RestoredAt:      time.Now(),
+		Status:          "swapping",
+	}
+	for _, name := range staged {
+		exists, err := collectionExists(ctx, name)
+		if err != nil {
+			dropStaging(staged)
+			return summary, err
+		}
+		if !exists {
+			snapshot.Missing = append(snapshot.Missing, name)
+		}
+	}
+	if _, err := snapshots.ReplaceOne(ctx, bson.M{"_id": restoreSnapshotID}, snapshot, options.Replace().SetUpsert(true)); err != nil {
+		dropStaging(staged)
+		return summary, fmt.Errorf("erro ao registrar ponto de reversão: %w", err)
+	}
+	// Sem troca, vale de novo o ponto de reversão anterior
+	putBackSnapshot := func() {
+		if previous != nil {
+			snapshots.ReplaceOne(ctx, bson.M{"_id": restoreSnapshotID}, previous)
+		} else {
+			snapshots.DeleteOne(ctx, bson.M{"_id": restoreSnapshotID})
+		}
+	}
+
+	opts.report("swap", "", 0)
+	missing, err := swapStaging(ctx, staged)
+	if err != nil {
+		putBackSnapshot()
+		dropStaging(staged)
+		return summary, err
+	}
+
+	update := bson.M{"$set": bson.M{"missing": missing, "status": "done"}}
+	if _, err := snapshots.UpdateOne(ctx, bson.M{"_id": restoreSnapshotID}, update); err != nil {
+		// Sem o registro final a troca não poderia ser revertida: desfaz
+		unswapStaging(ctx, staged)
+		putBackSnapshot()
+		dropStaging(staged)
+		return summary, fmt.Errorf("erro ao registrar ponto de reversão: %w", err)
+	}
+	return summary, nil
+}
+
+// --- PONTO DE REVERSÃO DA ÚLTIMA RESTAURAÇÃO (Admin) ---
+func GetRestoreSnapshot(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var snapshot restoreSnapshot
+	if err := Db.Collection("restore_snapshots").FindOne(ctx, bson.M{"_id": restoreSnapshotID}).Decode(&snapshot); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Nenhuma restauração para reverter."})
+	}
+	return c.JSON(snapshot)
+}
+
+// --- REVERTER A ÚLTIMA RESTAURAÇÃO (Admin) ---
+// Troca as coleções atuais pelas guardadas. Chamar de novo desfaz a reversão.
+func RollbackRestore(c *fiber.Ctx) error {
+	username, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem reverter restaurações."})
+	}
+
+	if !restoreMu.TryLock() {
+		return c.Status(409).JSON(fiber.Map{"error": "Existe uma restauração em andamento."})
+	}
+	defer restoreMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	var snapshot restoreSnapshot
+	if err := Db.Collection("restore_snapshots").FindOne(ctx, bson.M{"_id": restoreSnapshotID}).Decode(&snapshot); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Nenhuma restauração para reverter."})
+	}
+
+	missing := map[string]bool{}
+	for _, name := range snapshot.Missing {
+		missing[name] = true
+	}
+
+	var swapped, nowMissing []string
+	for _, name := range snapshot.Collections {
+		hasRollback, err := collectionExists(ctx, rollbackPrefix+name)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Erro ao verificar " + name})
+		}
+		if !hasRollback && !missing[name] {
+			return c.Status(409).JSON(fiber.Map{"error": "Cópia anterior de " + name + " não encontrada.", "swapped": swapped})
+		}
+
+		// atual -> swap, rollback -> atual, swap -> rollback
+		liveExists := true
+		if err := renameCollection(ctx, name, swapPrefix+name, true); err != nil {
+			if !isNamespaceNotFound(err) {
+				return c.Status(500).JSON(fiber.Map{"error": "Erro ao reverter " + name, "swapped": swapped})
+			}
+			liveExists = false
+		}
+		if hasRollback {
+			if err := renameCollection(ctx, rollbackPrefix+name, name, false); err != nil {
+				if liveExists {
+					renameCollection(ctx, swapPrefix+name, name, false)
+				}
+				return c.Status(500).JSON(fiber.Map{"error": "Erro ao reverter " + name, "swapped": swapped})
+			}
+		}
+		if liveExists {
+			if err := renameCollection(ctx, swapPrefix+name, rollbackPrefix+name, true); err != nil {
+				log.Printf("❌ Erro ao guardar %s após reversão: %v", name, err)
+			}
+		} else {
+			// Não havia dados atuais: a próxima troca só remove a coleção
+			nowMissing = append(nowMissing, name)
+		}
+		swapped = append(swapped, name)
+	}
+
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"missing": nowMissing, "rolled_back_by": username, "rolled_back_at": now}}
+	Db.Collection("restore_snapshots").UpdateOne(ctx, bson.M{"_id": restoreSnapshotID}, update)
+
+	return c.JSON(fiber.Map{"message": "Restauração revertida. Os dados substituídos continuam guardados para nova troca.", "collections": swapped})
+}
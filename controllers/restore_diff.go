@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Viagens de exemplo por tipo de mudança no relatório de simulação
+const restoreDiffSamples = 20
+
+// Máximo de documentos inválidos listados
+const restoreDiffInvalid = 50
+
+type collectionDiff struct {
+	Backup    int `json:"backup"`
+	Live      int `json:"live"`
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Modified  int `json:"modified"`
+	Unchanged int `json:"unchanged"`
+}
+
+// Viagem que mudaria com a restauração
+type tripChange struct {
+	ID        string   `json:"id"`
+	Change    string   `json:"change"` // added, removed, modified
+	Route     string   `json:"route"`
+	Driver    string   `json:"driver"`
+	StartDate string   `json:"start_date"`
+	Fields    []string `json:"fields,omitempty"` // Campos alterados (modified)
+}
+
+type restoreDiff struct {
+	Mode          string                     `json:"mode"`
+	FormatVersion int                        `json:"format_version"`
+	SchemaVersion int                        `json:"schema_version"`
+	Migrations    []string                   `json:"migrations,omitempty"`
+	Timestamp     time.Time                  `json:"timestamp"`
+	Signed        bool                       `json:"signed"` // Falso quando aceito por allow_unsigned
+	Valid         bool                       `json:"valid"`
+	Invalid       []string                   `json:"invalid,omitempty"`
+	Collections   map[string]*collectionDiff `json:"collections"`
+	Skipped       []string                   `json:"skipped,omitempty"`
+	TripSamples   []tripChange               `json:"trip_samples"`
+}
+
+// Chave do documento: tipo + bytes do _id (funciona para ObjectID, string, número...)
+func docKey(doc bson.Raw) string {
+	id := doc.Lookup("_id")
+	return string(append([]byte{byte(id.Type)}, id.Value...))
+}
+
+func tripSample(doc bson.Raw, change string) tripChange {
+	str := func(key string) string {
+		value, _ := doc.Lookup(key).StringValueOK()
+		return value
+	}
+	id := doc.Lookup("_id")
+	idText := id.String()
+	if oid, ok := id.ObjectIDOK(); ok {
+		idText = oid.Hex()
+	}
+	return tripChange{ID: idText, Change: change, Route: str("route"), Driver: str("driver"), StartDate: str("start_date")}
+}
+
+// Campos de primeiro nível diferentes entre as duas versões
+func changedFields(live, backup bson.Raw) []string {
+	liveValues := map[string][]byte{}
+	if elems, err := live.Elements(); err == nil {
+		for _, e := range elems {
+			v := e.Value()
+			liveValues[e.Key()] = append([]byte{byte(v.Type)}, v.Value...)
+		}
+	}
+
+	var fields []string
+	if elems, err := backup.Elements(); err == nil {
+		for _, e := range elems {
+			v := e.Value()
+			current, ok := liveValues[e.Key()]
+			if !ok || !bytes.Equal(current, append([]byte{byte(v.Type)}, v.Value...)) {
+				fields = append(fields, e.Key())
+			}
+			delete(liveValues, e.Key())
+		}
+	}
+	for key := range liveValues {
+		fields = append(fields, key)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Hash de cada documento da coleção atual, por _id
+func liveHashes(ctx context.Context, collection string) (map[string][32]byte, error) {
+	hashes := map[string][32]byte{}
+	cursor, err := Db.Collection(collection).Find(ctx, bson.M{}, options.Find().SetBatchSize(restoreBatchSize))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		hashes[docKey(cursor.Current)] = sha256.Sum256(cursor.Current)
+	}
+	return hashes, cursor.Err()
+}
+
+// Simula a restauração: lê e valida o arquivo e compara com o banco, sem gravar nada.
+// Só os hashes da coleção atual ficam em memória.
+// Com filtros ou no modo merge nada seria removido.
+func diffBackup(ctx context.Context, r io.Reader, opts restoreOptions) (restoreDiff, error) {
+	reader, err := newBackupReader(r, opts.Security)
+	if err != nil {
+		return restoreDiff{}, err
+	}
+
+	diff := restoreDiff{
+		Mode:          restoreReplace,
+		FormatVersion: reader.Header.FormatVersion,
+		SchemaVersion: reader.Header.SchemaVersion,
+		Migrations:    migrationDescriptions(reader.Migrations),
+		Timestamp:     reader.Header.Timestamp,
+		Collections:   map[string]*collectionDiff{},
+		TripSamples:   []tripChange{},
+	}
+	if opts.merge() {
+		diff.Mode = restoreMerge
+	}
+	samples := map[string]int{}
+	addSample := func(change tripChange) {
+		if samples[change.Change] < restoreDiffSamples {
+			samples[change.Change]++
+			diff.TripSamples = append(diff.TripSamples, change)
+		}
+	}
+	invalid := func(format string, args ...interface{}) {
+		if len(diff.Invalid) < restoreDiffInvalid {
+			diff.Invalid = append(diff.Invalid, fmt.Sprintf(format, args...))
+		}
+	}
+
+	var current string
+	var live map[string][32]byte
+	var stats *collectionDiff
+
+	// Documentos que só existem no banco seriam removidos
+	finish := func() {
+		if current == "" || opts.merge() {
+			return
+		}
+		stats.Removed = len(live)
+		if current == "trips" {
+			for key := range live {
+				if samples["removed"] >= restoreDiffSamples {
+					break
+				}
+				var doc bson.Raw
+				idValue := bson.RawValue{Type: bsontype.Type(key[0]), Value: []byte(key[1:])}
+				if err := Db.Collection("trips").FindOne(ctx, bson.M{"_id": idValue}).Decode(&doc); err == nil {
+					addSample(tripSample(doc, "removed"))
+				}
+			}
+		}
+	}
+
+	for {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return diff, err
+		}
+
+		if entry.Doc == nil {
+			finish()
+			current = ""
+			if !isBackupCollection(entry.Collection) {
+				diff.Skipped = append(diff.Skipped, entry.Collection)
+				continue
+			}
+			if !opts.wantsCollection(entry.Collection) {
+				continue
+			}
+			current = entry.Collection
+			if live, err = liveHashes(ctx, current); err != nil {
+				return diff, fmt.Errorf("erro ao ler %s: %w", current, err)
+			}
+			stats = &collectionDiff{Live: len(live)}
+			diff.Collections[current] = stats
+			continue
+		}
+		if current == "" || !opts.wantsDoc(current, entry.Doc) {
+			continue
+		}
+
+		stats.Backup++
+		if err := validateRestoreDoc(current, entry.Doc); err != nil {
+			invalid("%s: documento %d: %v", current, stats.Backup, err)
+			continue
+		}
+
+		key := docKey(entry.Doc)
+		hash, exists := live[key]
+		delete(live, key)
+
+		switch {
+		case !exists:
+			stats.Added++
+			if current == "trips" {
+				addSample(tripSample(entry.Doc, "added"))
+			}
+		case hash != sha256.Sum256(entry.Doc):
+			stats.Modified++
+			if current == "trips" && samples["modified"] < restoreDiffSamples {
+				change := tripSample(entry.Doc, "modified")
+				var liveDoc bson.Raw
+				if err := Db.Collection("trips").FindOne(ctx, bson.M{"_id": entry.Doc.Lookup("_id")}).Decode(&liveDoc); err == nil {
+					change.Fields = changedFields(liveDoc, entry.Doc)
+				}
+				addSample(change)
+			}
+		default:
+			stats.Unchanged++
+		}
+	}
+	finish()
+	diff.Signed = reader.Signed
+
+	diff.Valid = len(diff.Invalid) == 0 && len(diff.Collections) > 0
+	if len(diff.Collections) == 0 {
+		diff.Invalid = append(diff.Invalid, "nenhuma coleção conhecida no arquivo")
+	}
+	return diff, nil
+}
+
+// Resposta do modo simulação de RestoreBackup (?dry_run=true)
+func restoreDryRun(c *fiber.Ctx, ctx context.Context, r io.Reader, opts restoreOptions) error {
+	diff, err := diffBackup(ctx, r, opts)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Arquivo inválido ou corrompido: " + err.Error()})
+	}
+	return c.JSON(diff)
+}
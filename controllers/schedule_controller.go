@@ -0,0 +1,481 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/cron"
+	"backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Formatos aceitos por relatório (o primeiro é o padrão)
+var scheduleFormats = map[string][]string{
+	"closing":       {"json"},
+	"trips":         {"xlsx"},
+	"profitability": {"json"},
+	"statement":     {"pdf", "csv", "json"},
+}
+
+// Período relativo à data de execução (semana começa na segunda)
+func schedulePeriod(period string, now time.Time) (time.Time, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	switch period {
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today.AddDate(0, 0, -1), nil
+	case "last_7_days":
+		return today.AddDate(0, 0, -7), today.AddDate(0, 0, -1), nil
+	case "current_week":
+		return monday, today, nil
+	case "last_week":
+		return monday.AddDate(0, 0, -7), monday.AddDate(0, 0, -1), nil
+	case "current_month":
+		return firstOfMonth, today, nil
+	case "last_month":
+		return firstOfMonth.AddDate(0, -1, 0), firstOfMonth.AddDate(0, 0, -1), nil
+	}
+	return time.Time{}, time.Time{}, errors.New("Período inválido")
+}
+
+func validateSchedule(s *models.ReportSchedule) error {
+	if strings.TrimSpace(s.Name) == "" {
+		return errors.New("Informe o nome do agendamento")
+	}
+	if _, err := cron.Parse(s.Cron); err != nil {
+		return errors.New("Expressão cron inválida: " + err.Error())
+	}
+	formats, ok := scheduleFormats[s.Report]
+	if !ok {
+		return errors.New("Relatório inválido (use closing, trips, profitability ou statement)")
+	}
+	if s.Format == "" {
+		s.Format = formats[0]
+	}
+	valid := false
+	for _, f := range formats {
+		if f == s.Format {
+			valid = true
+		}
+	}
+	if !valid {
+		return fmt.Errorf("Formato inválido para o relatório (use %s)", strings.Join(formats, ", "))
+	}
+	if _, _, err := schedulePeriod(s.Period, time.Now()); err != nil {
+		return err
+	}
+	if s.Report == "statement" && s.Filters.User == "" && s.Filters.Driver == "" {
+		return errors.New("O extrato exige o usuário ou o motorista nos filtros")
+	}
+	if s.Report == "profitability" {
+		if s.Filters.GroupBy == "" {
+			s.Filters.GroupBy = "route"
+		}
+		if _, ok := profitGroupFields[s.Filters.GroupBy]; !ok {
+			return errors.New("Agrupamento inválido (use route, vehicle, driver ou trip)")
+		}
+	}
+	return nil
+}
+
+// Gera o conteúdo do relatório no formato configurado
+func renderScheduledReport(ctx context.Context, s models.ReportSchedule, from, to time.Time) ([]byte, error) {
+	query := tripQuery{
+		From:    from.Format(dateLayout),
+		To:      to.Format(dateLayout),
+		Route:   s.Filters.Route,
+		Driver:  s.Filters.Driver,
+		Vehicle: s.Filters.Vehicle,
+		User:    s.Filters.User,
+		Status:  s.Filters.Status,
+	}
+	filter, err := query.filter("", true)
+	if err != nil {
+		return nil, err
+	}
+
+	switch s.Report {
+	case "closing":
+		report, err := buildClosingReport(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		report.From, report.To = query.From, query.To
+		return json.MarshalIndent(report, "", "  ")
+
+	case "trips":
+		cursor, err := Db.Collection("trips").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "start_date", Value: 1}}))
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+		var buf bytes.Buffer
+		if err := writeTripsWorkbook(ctx, &buf, cursor); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+
+	case "profitability":
+		report, err := buildProfitabilityReport(ctx, filter, s.Filters.GroupBy, to)
+		if err != nil {
+			return nil, err
+		}
+		report.From, report.To = query.From, query.To
+		return json.MarshalIndent(report, "", "  ")
+
+	case "statement":
+		statement, err := buildStatement(ctx, s.Filters.User, s.Filters.Driver, from, to)
+		if err != nil {
+			return nil, err
+		}
+		switch s.Format {
+		case "csv":
+			return statementCSV(statement, ';')
+		case "pdf":
+			return statementPDF(statement), nil
+		}
+		return json.MarshalIndent(statement, "", "  ")
+	}
+	return nil, errors.New("relatório desconhecido: " + s.Report)
+}
+
+// Gera o relatório, grava em REPORTS_DIR e registra no histórico
+func runScheduledReport(ctx context.Context, s models.ReportSchedule, trigger string) models.ReportRun {
+	now := time.Now()
+	run := models.ReportRun{
+		ID:         primitive.NewObjectID(),
+		ScheduleID: s.ID,
+		Name:       s.Name,
+		Report:     s.Report,
+		Format:     s.Format,
+		Trigger:    trigger,
+		StartedAt:  now,
+	}
+
+	fail := func(err error) models.ReportRun {
+		run.Status = "failed"
+		run.Error = err.Error()
+		run.FinishedAt = time.Now()
+		log.Printf("❌ Erro no relatório agendado %q: %v", s.Name, err)
+		if _, err := Db.Collection("report_runs").InsertOne(ctx, run); err != nil {
+			log.Println("❌ Erro ao registrar execução do relatório:", err)
+		}
+		return run
+	}
+
+	from, to, err := schedulePeriod(s.Period, now)
+	if err != nil {
+		return fail(err)
+	}
+	run.From = from.Format(dateLayout)
+	run.To = to.Format(dateLayout)
+
+	data, err := renderScheduledReport(ctx, s, from, to)
+	if err != nil {
+		return fail(err)
+	}
+
+	slug := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(s.Name))
+
+	run.File = filepath.Join(now.Format("2006-01"), fmt.Sprintf("%s_%s_%s_%s.%s", slug, run.From, run.To, run.ID.Hex(), s.Format))
+	path := filepath.Join(config.GetReportsDir(), run.File)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fail(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fail(err)
+	}
+
+	run.Status = "success"
+	run.Size = int64(len(data))
+	run.FinishedAt = time.Now()
+	if _, err := Db.Collection("report_runs").InsertOne(ctx, run); err != nil {
+		log.Println("❌ Erro ao registrar execução do relatório:", err)
+	}
+	return run
+}
+
+// Executa os agendamentos vencidos. Cada um é "reservado" avançando o next_run
+// antes de gerar, para não rodar duas vezes se houver mais de uma instância da API.
+func runDueReports(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	var schedules []models.ReportSchedule
+	cursor, err := Db.Collection("report_schedules").Find(ctx, bson.M{"active": true, "next_run": bson.M{"$lte": now}})
+	if err != nil {
+		log.Println("❌ Erro ao buscar relatórios agendados:", err)
+		return
+	}
+	if err := cursor.All(ctx, &schedules); err != nil {
+		log.Println("❌ Erro ao ler relatórios agendados:", err)
+		return
+	}
+
+	for _, s := range schedules {
+		schedule, err := cron.Parse(s.Cron)
+		if err != nil {
+			continue
+		}
+
+		set := bson.M{"last_run": now}
+		if next := schedule.Next(now); !next.IsZero() {
+			set["next_run"] = next
+		} else {
+			set["active"] = false
+		}
+		result, err := Db.Collection("report_schedules").UpdateOne(ctx,
+			bson.M{"_id": s.ID, "next_run": s.NextRun},
+			bson.M{"$set": set})
+		if err != nil || result.ModifiedCount == 0 {
+			continue
+		}
+
+		runScheduledReport(ctx, s, "schedule")
+	}
+}
+
+// Inicia o agendador (verifica a cada minuto cheio)
+func StartReportScheduler() {
+	go func() {
+		for {
+			now := time.Now()
+			time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+			runDueReports(time.Now())
+		}
+	}()
+}
+
+// --- AGENDAMENTOS DE RELATÓRIO (Admin) ---
+func GetReportSchedules(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var schedules []models.ReportSchedule
+	cursor, err := Db.Collection("report_schedules").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar agendamentos"})
+	}
+	cursor.All(ctx, &schedules)
+
+	if schedules == nil {
+		schedules = []models.ReportSchedule{}
+	}
+	return c.JSON(schedules)
+}
+
+// Cria (sem id) ou atualiza (com id) o agendamento
+func SaveReportSchedule(c *fiber.Ctx) error {
+	username, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	var input models.ReportSchedule
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Dados inválidos"})
+	}
+	if err := validateSchedule(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	schedule, _ := cron.Parse(input.Cron)
+	next := schedule.Next(time.Now())
+	if next.IsZero() {
+		return c.Status(400).JSON(fiber.Map{"error": "A expressão cron nunca será executada"})
+	}
+	input.NextRun = &next
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if input.ID.IsZero() {
+		input.ID = primitive.NewObjectID()
+		input.LastRun = nil
+		input.CreatedBy = username
+		input.CreatedAt = time.Now()
+		if _, err := Db.Collection("report_schedules").InsertOne(ctx, input); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar agendamento"})
+		}
+		return c.Status(201).JSON(input)
+	}
+
+	update := bson.M{"$set": bson.M{
+		"name":     input.Name,
+		"cron":     input.Cron,
+		"report":   input.Report,
+		"format":   input.Format,
+		"period":   input.Period,
+		"filters":  input.Filters,
+		"active":   input.Active,
+		"next_run": input.NextRun,
+	}}
+	result, err := Db.Collection("report_schedules").UpdateOne(ctx, bson.M{"_id": input.ID}, update)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar agendamento"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Agendamento não encontrado."})
+	}
+	return c.JSON(fiber.Map{"message": "Salvo com sucesso", "next_run": input.NextRun})
+}
+
+func DeleteReportSchedule(c *fiber.Ctx) error {
+	return deleteAdminDocument(c, "report_schedules", "Agendamento não encontrado.")
+}
+
+// Gera o relatório agora, sem alterar a próxima execução
+func RunReportScheduleNow(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+	}
+
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	var schedule models.ReportSchedule
+	if err := Db.Collection("report_schedules").FindOne(ctx, bson.M{"_id": objID}).Decode(&schedule); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Agendamento não encontrado."})
+	}
+
+	run := runScheduledReport(ctx, schedule, "manual")
+	if run.Status != "success" {
+		return c.Status(500).JSON(run)
+	}
+	return c.JSON(run)
+}
+
+// --- HISTÓRICO DE RELATÓRIOS GERADOS (Admin) ---
+// ?schedule_id= (opcional), ?limit= (padrão 100)
+func GetReportRuns(c *fiber.Ctx) error {
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	filter := bson.M{}
+	if id := c.Query("schedule_id"); id != "" {
+		objID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+		}
+		filter["schedule_id"] = objID
+	}
+
+	limit := int64(c.QueryInt("limit", 100))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var runs []models.ReportRun
+	opts := options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}}).SetLimit(limit)
+	cursor, err := Db.Collection("report_runs").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar histórico"})
+	}
+	cursor.All(ctx, &runs)
+
+	if runs == nil {
+		runs = []models.ReportRun{}
+	}
+	return c.JSON(runs)
+}
+
+var reportContentTypes = map[string]string{
+	"json": "application/json",
+	"csv":  "text/csv; charset=utf-8",
+	"pdf":  "application/pdf",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+func DownloadReportRun(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+	}
+
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var run models.ReportRun
+	if err := Db.Collection("report_runs").FindOne(ctx, bson.M{"_id": objID}).Decode(&run); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Relatório não encontrado."})
+	}
+	if run.File == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "Esta execução falhou e não gerou arquivo."})
+	}
+
+	path := filepath.Join(config.GetReportsDir(), filepath.Clean("/"+run.File))
+	if _, err := os.Stat(path); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Arquivo do relatório não está mais disponível."})
+	}
+
+	c.Set("Content-Disposition", "attachment; filename="+filepath.Base(run.File))
+	c.Set("Content-Type", reportContentTypes[run.Format])
+	return c.SendFile(path)
+}
+
+// Exclui o registro e o arquivo gerado
+func DeleteReportRun(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+	}
+
+	_, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a administradores."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var run models.ReportRun
+	if err := Db.Collection("report_runs").FindOneAndDelete(ctx, bson.M{"_id": objID}).Decode(&run); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Relatório não encontrado."})
+	}
+	if run.File != "" {
+		os.Remove(filepath.Join(config.GetReportsDir(), filepath.Clean("/"+run.File)))
+	}
+
+	return c.JSON(fiber.Map{"message": "Excluído com sucesso!"})
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Versão do esquema dos documentos (models). Suba ao mudar o formato gravado de
+// alguma coleção e registre em schemaMigrations como converter os documentos antigos.
+// Backups sem o campo schema_version são da versão 1.
+var schemaVersion = 1
+
+// Converte os documentos de uma coleção da versão To-1 para To
+type schemaMigration struct {
+	To          int
+	Description string
+	Collections map[string]func(doc bson.D) bson.D
+}
+
+// Executadas em ordem sobre os documentos de backups antigos na restauração.
+// Ainda não houve mudança de esquema: os documentos são restaurados como estão.
+var schemaMigrations = []schemaMigration{}
+
+// Auxiliares para as migrações
+func docValue(doc bson.D, key string) (interface{}, bool) {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+func docWithout(doc bson.D, key string) bson.D {
+	result := doc[:0:0]
+	for _, e := range doc {
+		if e.Key != key {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Migrações necessárias para levar um backup da versão from à atual
+func pendingMigrations(from int) []schemaMigration {
+	var pending []schemaMigration
+	for _, m := range schemaMigrations {
+		if m.To > from {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+func migrationDescriptions(migrations []schemaMigration) []string {
+	var descriptions []string
+	for _, m := range migrations {
+		descriptions = append(descriptions, fmt.Sprintf("v%d: %s", m.To, m.Description))
+	}
+	return descriptions
+}
+
+// Aplica as migrações ao documento. Sem migração para a coleção, devolve os mesmos bytes.
+func migrateDocument(pending []schemaMigration, collection string, raw bson.Raw) (bson.Raw, error) {
+	var doc bson.D
+	decoded := false
+	for _, m := range pending {
+		migrate, ok := m.Collections[collection]
+		if !ok {
+			continue
+		}
+		if !decoded {
+			if err := bson.Unmarshal(raw, &doc); err != nil {
+				return nil, err
+			}
+			decoded = true
+		}
+		doc = migrate(doc)
+	}
+	if !decoded {
+		return raw, nil
+	}
+
+	migrated, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("migração do esquema: %w", err)
+	}
+	return migrated, nil
+}
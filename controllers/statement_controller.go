@@ -0,0 +1,396 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/pdf"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- LISTAR ACERTOS ---
+// Admin vê todos (?user=&driver= filtram); usuário comum vê apenas os próprios
+func GetSettlements(c *fiber.Ctx) error {
+	username, isAdmin := getUserFromToken(c)
+	if username == "" && !isAdmin {
+		return c.Status(401).JSON(fiber.Map{"error": "Usuário não identificado"})
+	}
+
+	filter := bson.M{}
+	if !isAdmin {
+		filter["user_id"] = username
+	} else if user := c.Query("user"); user != "" {
+		filter["user_id"] = user
+	}
+	if driver := c.Query("driver"); driver != "" {
+		filter["driver"] = driver
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}})
+
+	var settlements []models.Settlement
+	cursor, err := Db.Collection("settlements").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar acertos"})
+	}
+	cursor.All(ctx, &settlements)
+
+	if settlements == nil {
+		settlements = []models.Settlement{}
+	}
+	return c.JSON(settlements)
+}
+
+// --- REGISTRAR ACERTO (Admin) ---
+func SaveSettlement(c *fiber.Ctx) error {
+	username, isAdmin := getUserFromToken(c)
+	if !isAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem registrar acertos."})
+	}
+
+	var input models.Settlement
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Dados inválidos"})
+	}
+	if input.UserID == "" && input.Driver == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Informe o usuário ou o motorista"})
+	}
+	if input.Amount == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Informe o valor do acerto"})
+	}
+	// Gravada como YYYY-MM-DD: o extrato compara as datas como texto
+	date, err := parseDate(input.Date)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Data inválida"})
+	}
+	input.Date = date.Format(dateLayout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if input.ID.IsZero() {
+		input.ID = primitive.NewObjectID()
+		input.CreatedBy = username
+		input.CreatedAt = time.Now()
+		_, err = Db.Collection("settlements").InsertOne(ctx, input)
+	} else {
+		_, err = Db.Collection("settlements").UpdateOne(ctx, bson.M{"_id": input.ID}, bson.M{"$set": bson.M{
+			"user_id": input.UserID,
+			"driver":  input.Driver,
+			"date":    input.Date,
+			"amount":  input.Amount,
+			"method":  input.Method,
+			"notes":   input.Notes,
+		}})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar acerto"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Salvo com sucesso", "id": input.ID})
+}
+
+func DeleteSettlement(c *fiber.Ctx) error {
+	return deleteAdminDocument(c, "settlements", "Acerto não encontrado.")
+}
+
+// Monta o extrato do usuário e/ou motorista no período, com saldo anterior
+func buildStatement(ctx context.Context, user, driver string, from, to time.Time) (models.Statement, error) {
+	statement := models.Statement{User: user, Driver: driver, Entries: []models.StatementEntry{}}
+	if !from.IsZero() {
+		statement.From = from.Format(dateLayout)
+	}
+	if !to.IsZero() {
+		statement.To = to.Format(dateLayout)
+	}
+
+	subject := bson.M{}
+	if user != "" {
+		subject["user_id"] = user
+	}
+	if driver != "" {
+		subject["driver"] = driver
+	}
+
+	// 1. Viagens do período e anteriores (saldo de abertura)
+	tripFilter := bson.M{}
+	for k, v := range subject {
+		tripFilter[k] = v
+	}
+	applyPeriodFilter(tripFilter, time.Time{}, to)
+
+	var trips []models.Trip
+	cursor, err := Db.Collection("trips").Find(ctx, tripFilter)
+	if err != nil {
+		return statement, err
+	}
+	if err := cursor.All(ctx, &trips); err != nil {
+		return statement, err
+	}
+
+	// 2. Acertos até o fim do período
+	settlementFilter := bson.M{}
+	for k, v := range subject {
+		settlementFilter[k] = v
+	}
+	if !to.IsZero() {
+		settlementFilter["date"] = bson.M{"$lt": to.AddDate(0, 0, 1).Format(dateLayout)}
+	}
+
+	var settlements []models.Settlement
+	cursor, err = Db.Collection("settlements").Find(ctx, settlementFilter)
+	if err != nil {
+		return statement, err
+	}
+	if err := cursor.All(ctx, &settlements); err != nil {
+		return statement, err
+	}
+
+	fromStr := statement.From
+	var entries []models.StatementEntry
+
+	for _, trip := range trips {
+		entry := models.StatementEntry{
+			Date:        trip.StartDate,
+			Type:        "trip",
+			ReferenceID: trip.ID.Hex(),
+			Description: strings.TrimSpace(fmt.Sprintf("Viagem %s - %s", trip.Route, trip.Driver)),
+			Withdrawn:   trip.ValueWithdraw,
+			Received:    trip.ValueReceived,
+			Expenses:    trip.TotalExpenses(),
+			Amount:      trip.Balance(),
+		}
+		if entry.Date < fromStr {
+			statement.OpeningBalance += entry.Amount
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, s := range settlements {
+		description := "Acerto"
+		if s.Method != "" {
+			description += " (" + s.Method + ")"
+		}
+		if s.Notes != "" {
+			description += " - " + s.Notes
+		}
+		entry := models.StatementEntry{
+			Date:        s.Date,
+			Type:        "settlement",
+			ReferenceID: s.ID.Hex(),
+			Description: description,
+			Settled:     s.Amount,
+			Amount:      -s.Amount,
+		}
+		if entry.Date < fromStr {
+			statement.OpeningBalance += entry.Amount
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	// Ordem cronológica; no mesmo dia a viagem vem antes do acerto
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Date != entries[j].Date {
+			return entries[i].Date < entries[j].Date
+		}
+		return entries[i].Type == "trip" && entries[j].Type != "trip"
+	})
+
+	balance := round2(statement.OpeningBalance)
+	statement.OpeningBalance = balance
+	for _, entry := range entries {
+		balance = round2(balance + entry.Amount)
+		entry.Balance = balance
+
+		statement.TotalWithdrawn += entry.Withdrawn
+		statement.TotalReceived += entry.Received
+		statement.TotalExpenses += entry.Expenses
+		statement.TotalSettled += entry.Settled
+		statement.Entries = append(statement.Entries, entry)
+	}
+	statement.ClosingBalance = balance
+
+	return statement, nil
+}
+
+// Extrato em CSV (";" para o Excel pt-BR)
+func statementCSV(statement models.Statement, sep rune) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("\xef\xbb\xbf")
+
+	writer := csv.NewWriter(&buf)
+	writer.Comma = sep
+	writer.Write([]string{"Data", "Tipo", "Descrição", "Retirado", "Recebido", "Despesas", "Acerto", "Valor", "Saldo"})
+	writer.Write([]string{formatDateBR(statement.From), "", "Saldo anterior", "", "", "", "", "", formatNumberBR(statement.OpeningBalance, 2)})
+
+	for _, e := range statement.Entries {
+		kind := "Viagem"
+		if e.Type == "settlement" {
+			kind = "Acerto"
+		}
+		writer.Write([]string{
+			formatDateBR(e.Date), kind, e.Description,
+			formatNumberBR(e.Withdrawn, 2), formatNumberBR(e.Received, 2), formatNumberBR(e.Expenses, 2),
+			formatNumberBR(e.Settled, 2), formatNumberBR(e.Amount, 2), formatNumberBR(e.Balance, 2),
+		})
+	}
+
+	writer.Write([]string{
+		formatDateBR(statement.To), "", "Totais",
+		formatNumberBR(statement.TotalWithdrawn, 2), formatNumberBR(statement.TotalReceived, 2), formatNumberBR(statement.TotalExpenses, 2),
+		formatNumberBR(statement.TotalSettled, 2), "", formatNumberBR(statement.ClosingBalance, 2),
+	})
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// Colunas do extrato em PDF: x final (alinhamento à direita) de cada valor
+var statementPDFColumns = []struct {
+	title string
+	right float64
+}{
+	{"Retirado", 320}, {"Recebido", 375}, {"Despesas", 430}, {"Acerto", 485}, {"Saldo", 545},
+}
+
+// Extrato em PDF (várias páginas quando necessário)
+func statementPDF(statement models.Statement) []byte {
+	company := config.GetCompanyInfo()
+	subject := statement.Driver
+	if subject == "" {
+		subject = statement.User
+	} else if statement.User != "" {
+		subject = statement.User + " / " + statement.Driver
+	}
+
+	doc := pdf.New("Extrato " + subject)
+	var page *pdf.Page
+	y := 0.0
+
+	newPage := func() {
+		page = doc.AddPage()
+		page.Text(50, 50, 14, pdf.Bold, company.Name)
+		page.TextRight(545, 50, 12, pdf.Bold, "EXTRATO DE ACERTO")
+		page.Text(50, 68, 10, pdf.Regular, "Motorista/Usuário: "+subject)
+		page.TextRight(545, 68, 10, pdf.Regular, fmt.Sprintf("Período: %s a %s", formatDateBR(statement.From), formatDateBR(statement.To)))
+
+		y = 92
+		page.Text(50, y, 8, pdf.Bold, "Data")
+		page.Text(100, y, 8, pdf.Bold, "Descrição")
+		for _, col := range statementPDFColumns {
+			page.TextRight(col.right, y, 8, pdf.Bold, col.title)
+		}
+		y += 4
+		page.Line(50, y, 545, y, 0.5)
+		y += 12
+	}
+
+	row := func(date, description string, values []float64, font pdf.Font) {
+		if y > pdf.PageHeight-60 {
+			newPage()
+		}
+		page.Text(50, y, 8, font, date)
+		desc := description
+		for pdf.TextWidth(desc, 8, font) > 160 && len(desc) > 3 {
+			desc = string([]rune(desc)[:len([]rune(desc))-4]) + "..."
+		}
+		page.Text(100, y, 8, font, desc)
+		for i, value := range values {
+			if math.IsNaN(value) {
+				continue
+			}
+			page.TextRight(statementPDFColumns[i].right, y, 8, font, formatNumberBR(value, 2))
+		}
+		y += 12
+	}
+
+	blank := math.NaN()
+	newPage()
+	row(formatDateBR(statement.From), "Saldo anterior", []float64{blank, blank, blank, blank, statement.OpeningBalance}, pdf.Bold)
+	for _, e := range statement.Entries {
+		row(formatDateBR(e.Date), e.Description, []float64{e.Withdrawn, e.Received, e.Expenses, e.Settled, e.Balance}, pdf.Regular)
+	}
+	page.Line(50, y-8, 545, y-8, 0.5)
+	y += 2
+	row("", "Totais / Saldo final", []float64{statement.TotalWithdrawn, statement.TotalReceived, statement.TotalExpenses, statement.TotalSettled, statement.ClosingBalance}, pdf.Bold)
+
+	y += 10
+	if statement.ClosingBalance >= 0 {
+		page.Text(50, y, 10, pdf.Bold, "Saldo a devolver pelo motorista: "+formatBRL(statement.ClosingBalance))
+	} else {
+		page.Text(50, y, 10, pdf.Bold, "Saldo a receber pelo motorista: "+formatBRL(-statement.ClosingBalance))
+	}
+	page.Text(50, pdf.PageHeight-40, 8, pdf.Regular, "Gerado em "+time.Now().Format("02/01/2006 15:04"))
+
+	return doc.Bytes()
+}
+
+// --- EXTRATO DO MOTORISTA / USUÁRIO ---
+// ?user=&driver=&from=&to= (padrão: mês corrente) e ?format=json|csv|pdf
+// Usuário comum só consegue o próprio extrato.
+func GetStatement(c *fiber.Ctx) error {
+	username, isAdmin := getUserFromToken(c)
+	if username == "" && !isAdmin {
+		return c.Status(401).JSON(fiber.Map{"error": "Usuário não identificado"})
+	}
+
+	user := c.Query("user")
+	driver := c.Query("driver")
+	if !isAdmin {
+		user = username
+	}
+	if user == "" && driver == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Informe o usuário ou o motorista"})
+	}
+
+	query := tripQuery{From: c.Query("from"), To: c.Query("to")}
+	query.defaultToCurrentMonth(time.Now())
+	from, to, err := periodFromQuery(query.From, query.To)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Período inválido"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	statement, err := buildStatement(ctx, user, driver, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao gerar extrato"})
+	}
+
+	name := strings.NewReplacer(" ", "_", "/", "-").Replace(strings.TrimSpace(user + "_" + driver))
+	filename := fmt.Sprintf("extrato_%s_%s", strings.Trim(name, "_"), statement.From)
+
+	switch c.Query("format", "json") {
+	case "csv":
+		data, err := statementCSV(statement, csvSeparator(c.Query("sep")))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Erro ao gerar CSV"})
+		}
+		c.Set("Content-Disposition", "attachment; filename="+filename+".csv")
+		c.Set("Content-Type", "text/csv; charset=utf-8")
+		return c.Send(data)
+	case "pdf":
+		c.Set("Content-Disposition", "inline; filename="+filename+".pdf")
+		c.Set("Content-Type", "application/pdf")
+		return c.Send(statementPDF(statement))
+	}
+
+	return c.JSON(statement)
+}
@@ -60,10 +60,10 @@ func GetAllTrips(c *fiber.Ctx) error {
 		return c.Status(401).JSON(fiber.Map{"error": "Usuário não identificado"})
 	}
 
-	filter := bson.M{}
-
-	if !isAdmin {
-		filter = bson.M{"user_id": username}
+	// Filtros opcionais (?from=&to=&route=&driver=&vehicle=&user=&status=)
+	filter, err := tripQueryFromCtx(c).filter(username, isAdmin)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Período inválido"})
 	}
 
 	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
@@ -112,27 +112,64 @@ func CreateTrip(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Dados inválidos"})
 	}
 
-	username, _ := getUserFromToken(c)
+	username, isAdmin := getUserFromToken(c)
 	if username == "" {
 		return c.Status(401).JSON(fiber.Map{"error": "Erro de autenticação"})
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := applyRefuels(trip); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := applyAssistants(ctx, trip, nil, isAdmin); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	applyPerDiemAutoFill(ctx, trip)
+
+	// Campos controlados pelo servidor nunca vêm do corpo
+	trip.ID = primitive.NilObjectID
 	trip.CreatedAt = time.Now()
 	trip.UserID = username
 	trip.Approved = false
-	// Por padrão, approval_viewed será false na criação, o que está correto
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	trip.ApprovalViewed = false
+	trip.ApprovedBy = ""
+	trip.ApprovedAt = nil
+	trip.VerificationCode = ""
+	trip.AccountingBatch = ""
+	trip.AccountingExportedAt = nil
+	trip.AccountingExported = nil
+	trip.AccountingCorrection = false
+	trip.PayrollBatch = ""
+	trip.PayrollExportedAt = nil
+	trip.PayrollExported = nil
+	trip.PayrollCorrection = false
+	trip.Anomalies = nil
+	trip.AnomalyReview = nil
 
 	result, err := Db.Collection("trips").InsertOne(ctx, trip)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar"})
 	}
 
+	// Compara com o histórico da rota (falha aqui não impede o lançamento)
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		refreshTripAnomalies(ctx, id)
+	}
+
 	return c.Status(201).JSON(fiber.Map{"message": "Sucesso", "id": result.InsertedID})
 }
 
+// Campos que o lançador pode alterar em UpdateTrip. Aprovação, código do comprovante,
+// lotes de exportação e anomalias são controlados pelo servidor.
+var editableTripFields = map[string]bool{
+	"route": true, "start_date": true, "end_date": true, "driver": true, "vehicle": true,
+	"km_start": true, "km_end": true, "value_withdraw": true, "value_received": true, "return_notes": true,
+	"expense_fuel": true, "expense_daily": true, "expense_assistant": true, "expense_toll": true, "expense_other": true,
+	"refuels": true, "assistants": true,
+}
+
 // --- ATUALIZAR VIAGEM ---
 func UpdateTrip(c *fiber.Ctx) error {
 	idParam := c.Params("id")
@@ -159,15 +196,48 @@ func UpdateTrip(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Dados inválidos"})
 	}
 
-	// Proteção de campos
-	delete(updateData, "_id")
-	delete(updateData, "created_at")
-	delete(updateData, "user_id")
-	delete(updateData, "approved")
-	delete(updateData, "approval_viewed") // Usuário não pode mudar isso manualmente
+	// Proteção de campos: só os editáveis chegam ao $set. Chaves com "." ou "$"
+	// (Ex: "anomaly_review.reviewed_by") nunca passam, pois não estão na lista.
+	for key := range updateData {
+		if !editableTripFields[key] {
+			delete(updateData, key)
+		}
+	}
+
+	// Campos calculados precisam da versão tipada do corpo
+	var typed models.Trip
+	if err := c.BodyParser(&typed); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Dados inválidos"})
+	}
+
+	if _, ok := updateData["refuels"]; ok {
+		if err := applyRefuels(&typed); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		updateData["refuels"] = typed.Refuels
+		if len(typed.Refuels) > 0 {
+			updateData["expense_fuel"] = typed.ExpenseFuel
+		}
+	} else if len(existingTrip.Refuels) > 0 {
+		// Com abastecimentos gravados, o combustível é sempre a soma deles
+		delete(updateData, "expense_fuel")
+	}
 
 	username, isAdmin := getUserFromToken(c)
 
+	if _, ok := updateData["assistants"]; ok {
+		if err := applyAssistants(ctx, &typed, existingTrip.Assistants, isAdmin); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		updateData["assistants"] = typed.Assistants
+		if len(typed.Assistants) > 0 {
+			updateData["expense_assistant"] = typed.ExpenseAssistant
+		}
+	} else if len(existingTrip.Assistants) > 0 {
+		// Com ajudantes gravados, o valor é sempre a soma das diárias deles
+		delete(updateData, "expense_assistant")
+	}
+
 	filter := bson.M{"_id": objID}
 	if !isAdmin {
 		filter["user_id"] = username
@@ -183,6 +253,8 @@ func UpdateTrip(c *fiber.Ctx) error {
 		return c.Status(403).JSON(fiber.Map{"error": "Sem permissão ou registro não encontrado."})
 	}
 
+	refreshTripAnomalies(ctx, objID)
+
 	return c.JSON(fiber.Map{"message": "Viagem atualizada com sucesso!", "id": idParam})
 }
 
@@ -194,7 +266,7 @@ func ApproveTrip(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
 	}
 
-	_, isAdmin := getUserFromToken(c)
+	username, isAdmin := getUserFromToken(c)
 	if !isAdmin {
 		return c.Status(403).JSON(fiber.Map{"error": "Apenas administradores podem aprovar fechamentos."})
 	}
@@ -207,6 +279,8 @@ func ApproveTrip(c *fiber.Ctx) error {
 	update := bson.M{"$set": bson.M{
 		"approved":        true,
 		"approval_viewed": false,
+		"approved_by":     username,
+		"approved_at":     time.Now(),
 	}}
 
 	result, err := Db.Collection("trips").UpdateOne(ctx, bson.M{"_id": objID}, update)
@@ -218,6 +292,8 @@ func ApproveTrip(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "Viagem não encontrada."})
 	}
 
+	refreshTripAnomalies(ctx, objID)
+
 	return c.JSON(fiber.Map{"message": "Fechamento aprovado e bloqueado com sucesso!"})
 }
 
@@ -237,7 +313,10 @@ func ReopenTrip(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	update := bson.M{"$set": bson.M{"approved": false}}
+	update := bson.M{
+		"$set":   bson.M{"approved": false},
+		"$unset": bson.M{"approved_by": "", "approved_at": "", "verification_code": ""},
+	}
 
 	result, err := Db.Collection("trips").UpdateOne(ctx, bson.M{"_id": objID}, update)
 	if err != nil {
@@ -248,6 +327,13 @@ func ReopenTrip(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "Viagem não encontrada."})
 	}
 
+	// Já exportada: o lote continua valendo e a próxima exportação leva só a diferença
+	for _, export := range []exportBatch{accountingExport, payrollExport} {
+		if err := export.flagCorrection(ctx, objID); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Erro ao reabrir viagem"})
+		}
+	}
+
 	return c.JSON(fiber.Map{"message": "Viagem reaberta para edição com sucesso!"})
 }
 
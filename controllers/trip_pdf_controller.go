@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/pdf"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Código de verificação do comprovante: HMAC do ID e dos dados impressos (XXXXX-XXXXX).
+// Qualquer alteração na viagem depois da emissão invalida o código já impresso.
+func verificationCode(trip models.Trip) string {
+	mac := hmac.New(sha256.New, config.GetJWTSecret())
+	fmt.Fprintf(mac, "trip-receipt:%s\n", trip.ID.Hex())
+	fmt.Fprintf(mac, "%q|%q|%q|%q|%q|%q|%q\n", trip.Route, trip.Driver, trip.Vehicle, trip.StartDate, trip.EndDate, trip.UserID, trip.ReturnNotes)
+	fmt.Fprintf(mac, "%v|%v|%v|%v\n", trip.KmStart, trip.KmEnd, trip.ValueWithdraw, trip.ValueReceived)
+	fmt.Fprintf(mac, "%v|%v|%v|%v|%v\n", trip.ExpenseFuel, trip.ExpenseDaily, trip.ExpenseAssistant, trip.ExpenseToll, trip.ExpenseOther)
+	for _, a := range trip.Assistants {
+		fmt.Fprintf(mac, "%q|%v|%v\n", a.Name, a.Days, a.Amount)
+	}
+	fmt.Fprintf(mac, "%v|%q", trip.Approved, trip.ApprovedBy)
+	if trip.ApprovedAt != nil {
+		fmt.Fprintf(mac, "|%d", trip.ApprovedAt.Unix())
+	}
+	code := base32.StdEncoding.EncodeToString(mac.Sum(nil))[:10]
+	return code[:5] + "-" + code[5:]
+}
+
+// Índice único do código: a consulta pública nunca pode achar duas viagens
+func EnsureVerificationIndex() {
+	if Db == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	index := mongo.IndexModel{
+		Keys: bson.D{{Key: "verification_code", Value: 1}},
+		Options: options.Index().
+			SetName("verification_code_unique").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"verification_code": bson.M{"$type": "string"}}),
+	}
+	if _, err := Db.Collection("trips").Indexes().CreateOne(ctx, index); err != nil {
+		fmt.Println("❌ Erro ao criar índice do código de verificação:", err)
+	}
+}
+
+// Posição de escrita do comprovante (y cresce para baixo)
+type receiptWriter struct {
+	doc   *pdf.Document
+	title string // Repetido no topo das páginas seguintes
+	pages []*pdf.Page
+	page  *pdf.Page
+	y     float64
+}
+
+const (
+	receiptLeft   = 50.0
+	receiptRight  = pdf.PageWidth - 50
+	receiptBottom = pdf.PageHeight - 70 // Abaixo fica o rodapé com o código de verificação
+)
+
+func (w *receiptWriter) addPage() {
+	w.page = w.doc.AddPage()
+	w.pages = append(w.pages, w.page)
+	w.y = 60
+}
+
+// Garante espaço para height pontos; senão continua em nova página
+func (w *receiptWriter) need(height float64) {
+	if w.y+height <= receiptBottom {
+		return
+	}
+	w.addPage()
+	w.page.Text(receiptLeft, w.y, 10, pdf.Bold, w.title+" (continuação)")
+	w.y += 6
+	w.page.Line(receiptLeft, w.y, receiptRight, w.y, 0.5)
+	w.y += 14
+}
+
+func (w *receiptWriter) section(title string) {
+	// Título não fica sozinho no fim da página
+	w.need(46)
+	w.y += 14
+	w.page.Text(receiptLeft, w.y, 11, pdf.Bold, title)
+	w.y += 4
+	w.page.Line(receiptLeft, w.y, receiptRight, w.y, 0.5)
+	w.y += 14
+}
+
+// Linha "rótulo ............ valor"
+func (w *receiptWriter) row(label, value string, font pdf.Font) {
+	w.need(14)
+	w.page.Text(receiptLeft+8, w.y, 10, font, label)
+	w.page.TextRight(receiptRight, w.y, 10, font, value)
+	w.y += 14
+}
+
+// Monta o PDF de fechamento da viagem
+func buildTripReceipt(trip models.Trip, code string) []byte {
+	company := config.GetCompanyInfo()
+	doc := pdf.New("Fechamento de Viagem " + trip.ID.Hex())
+	w := &receiptWriter{doc: doc, title: "Fechamento de Viagem Nº " + trip.ID.Hex()}
+	w.addPage()
+
+	// Cabeçalho
+	w.page.Text(receiptLeft, w.y, 16, pdf.Bold, company.Name)
+	w.page.TextRight(receiptRight, w.y, 13, pdf.Bold, "FECHAMENTO DE VIAGEM")
+	w.y += 14
+	var companyLines []string
+	if company.Document != "" {
+		companyLines = append(companyLines, "CNPJ: "+company.Document)
+	}
+	if company.Address != "" {
+		companyLines = append(companyLines, company.Address)
+	}
+	if company.Phone != "" {
+		companyLines = append(companyLines, "Telefone: "+company.Phone)
+	}
+	for _, line := range companyLines {
+		w.page.Text(receiptLeft, w.y, 9, pdf.Regular, line)
+		w.y += 11
+	}
+	w.page.TextRight(receiptRight, 74, 9, pdf.Regular, "Nº "+trip.ID.Hex())
+	w.y += 4
+	w.page.Line(receiptLeft, w.y, receiptRight, w.y, 1)
+
+	w.section("Dados da Viagem")
+	w.row("Rota", trip.Route, pdf.Regular)
+	w.row("Motorista", trip.Driver, pdf.Regular)
+	w.row("Veículo", trip.Vehicle, pdf.Regular)
+	w.row("Saída", formatDateBR(trip.StartDate), pdf.Regular)
+	w.row("Retorno", formatDateBR(trip.EndDate), pdf.Regular)
+	w.row("Lançado por", trip.UserID, pdf.Regular)
+
+	w.section("Quilometragem")
+	w.row("Km inicial", formatNumberBR(trip.KmStart, 0), pdf.Regular)
+	w.row("Km final", formatNumberBR(trip.KmEnd, 0), pdf.Regular)
+	w.row("Km rodados", formatNumberBR(trip.KmDriven(), 0), pdf.Bold)
+
+	w.section("Movimentação de Caixa")
+	w.row("Valor retirado", formatBRL(trip.ValueWithdraw), pdf.Regular)
+	w.row("Valor recebido", formatBRL(trip.ValueReceived), pdf.Regular)
+
+	w.section("Despesas")
+	w.row("Combustível", formatBRL(trip.ExpenseFuel), pdf.Regular)
+	w.row("Diárias", formatBRL(trip.ExpenseDaily), pdf.Regular)
+	w.row("Ajudantes", formatBRL(trip.ExpenseAssistant), pdf.Regular)
+	for _, a := range trip.Assistants {
+		w.row(fmt.Sprintf("    %s (%s dia(s) x %s)", a.Name, formatNumberBR(a.Days, 1), formatBRL(a.DailyRate)), formatBRL(a.Amount), pdf.Regular)
+	}
+	w.row("Pedágio", formatBRL(trip.ExpenseToll), pdf.Regular)
+	w.row("Outras", formatBRL(trip.ExpenseOther), pdf.Regular)
+	w.row("Total de despesas", formatBRL(trip.TotalExpenses()), pdf.Bold)
+
+	w.section("Saldo")
+	balance := trip.Balance()
+	if balance >= 0 {
+		w.row("Saldo a devolver pelo motorista", formatBRL(balance), pdf.Bold)
+	} else {
+		w.row("Saldo a receber pelo motorista", formatBRL(-balance), pdf.Bold)
+	}
+
+	if strings.TrimSpace(trip.ReturnNotes) != "" {
+		w.section("Observações")
+		for _, line := range pdf.WrapText(trip.ReturnNotes, receiptRight-receiptLeft-8, 10, pdf.Regular) {
+			w.need(13)
+			w.page.Text(receiptLeft+8, w.y, 10, pdf.Regular, line)
+			w.y += 13
+		}
+	}
+
+	w.section("Aprovação")
+	if trip.Approved {
+		approval := "Aprovado"
+		if trip.ApprovedBy != "" {
+			approval += " por " + trip.ApprovedBy
+		}
+		if trip.ApprovedAt != nil {
+			approval += " em " + trip.ApprovedAt.Local().Format("02/01/2006 15:04")
+		}
+		w.page.Text(receiptLeft+8, w.y, 10, pdf.Regular, approval)
+	} else {
+		w.page.Text(receiptLeft+8, w.y, 10, pdf.Bold, "PENDENTE DE APROVAÇÃO")
+	}
+	w.y += 14
+
+	// Assinaturas (linha + nome)
+	w.need(72)
+	signY := w.y + 60
+	if signY < 700 {
+		signY = 700
+	}
+	half := (receiptRight - receiptLeft) / 2
+	for i, label := range []string{"Motorista: " + trip.Driver, "Conferente / Responsável"} {
+		x := receiptLeft + float64(i)*half
+		w.page.Line(x+10, signY, x+half-10, signY, 0.5)
+		w.page.TextCenter(x+half/2, signY+12, 9, pdf.Regular, label)
+	}
+
+	// Rodapé com o código de verificação em todas as páginas
+	footerY := pdf.PageHeight - 40
+	generated := "Gerado em " + time.Now().Format("02/01/2006 15:04")
+	for i, page := range w.pages {
+		page.Line(receiptLeft, footerY-12, receiptRight, footerY-12, 0.5)
+		page.Text(receiptLeft, footerY, 8, pdf.Regular, "Código de verificação: ")
+		page.Text(receiptLeft+pdf.TextWidth("Código de verificação: ", 8, pdf.Regular), footerY, 8, pdf.Mono, code)
+		if len(w.pages) > 1 {
+			page.TextCenter(pdf.PageWidth/2, footerY, 8, pdf.Regular, fmt.Sprintf("Página %d de %d", i+1, len(w.pages)))
+		}
+		page.TextRight(receiptRight, footerY, 8, pdf.Regular, generated)
+	}
+
+	return doc.Bytes()
+}
+
+// --- PDF DO FECHAMENTO ---
+func GetTripPDF(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	username, isAdmin := getUserFromToken(c)
+
+	var trip models.Trip
+	if err := Db.Collection("trips").FindOne(ctx, bson.M{"_id": objID}).Decode(&trip); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Viagem não encontrada"})
+	}
+	if !isAdmin && trip.UserID != username {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso negado a este registro."})
+	}
+
+	// Grava o código na emissão para permitir a consulta reversa.
+	// Se a viagem mudou desde a última emissão, o código antigo deixa de valer.
+	if code := verificationCode(trip); trip.VerificationCode != code {
+		trip.VerificationCode = code
+		_, err := Db.Collection("trips").UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": bson.M{"verification_code": trip.VerificationCode}})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Erro ao registrar código de verificação"})
+		}
+	}
+
+	filename := fmt.Sprintf("fechamento_%s_%s.pdf", trip.StartDate, trip.ID.Hex())
+	c.Set("Content-Disposition", "inline; filename="+filename)
+	c.Set("Content-Type", "application/pdf")
+
+	return c.Send(buildTripReceipt(trip, trip.VerificationCode))
+}
+
+// --- CONFERIR COMPROVANTE PELO CÓDIGO (Rota Pública) ---
+func VerifyTripReceipt(c *fiber.Ctx) error {
+	code := strings.ToUpper(strings.TrimSpace(c.Params("code")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var trip models.Trip
+	if err := Db.Collection("trips").FindOne(ctx, bson.M{"verification_code": code}).Decode(&trip); err != nil {
+		return c.Status(404).JSON(fiber.Map{"valid": false, "error": "Código de verificação não encontrado"})
+	}
+	if verificationCode(trip) != code {
+		return c.Status(404).JSON(fiber.Map{"valid": false, "error": "Comprovante desatualizado: a viagem foi alterada depois da emissão"})
+	}
+
+	// Só os dados impressos no comprovante
+	return c.JSON(fiber.Map{
+		"valid":          true,
+		"trip_id":        trip.ID.Hex(),
+		"route":          trip.Route,
+		"driver":         trip.Driver,
+		"vehicle":        trip.Vehicle,
+		"start_date":     trip.StartDate,
+		"end_date":       trip.EndDate,
+		"approved":       trip.Approved,
+		"approved_at":    trip.ApprovedAt,
+		"total_expenses": trip.TotalExpenses(),
+		"balance":        trip.Balance(),
+	})
+}
@@ -0,0 +1,88 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func at(value string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseRejectsInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"* * * foo *",
+		"@every",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): esperado erro", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	cases := []struct {
+		name string
+		expr string
+		from string
+		want string // vazio: nunca casa
+	}{
+		{"passo nos minutos", "*/15 * * * *", "2026-03-10 10:07", "2026-03-10 10:15"},
+		{"estritamente depois", "*/15 * * * *", "2026-03-10 10:15", "2026-03-10 10:30"},
+		{"passo com início", "5/20 * * * *", "2026-03-10 10:45", "2026-03-10 11:05"},
+		{"intervalo com passo", "0 8-18/2 * * *", "2026-03-10 18:30", "2026-03-11 08:00"},
+		{"lista", "0 7 1,15 * *", "2026-03-02 00:00", "2026-03-15 07:00"},
+		{"nomes", "30 6 * jan-mar mon", "2026-03-31 00:00", "2027-01-04 06:30"},
+		{"domingo como 7", "0 0 * * 7", "2026-03-10 00:00", "2026-03-15 00:00"},
+		{"atalho", "@monthly", "2026-12-15 12:00", "2027-01-01 00:00"},
+
+		// Dia do mês e dia da semana restritos: basta um dos dois
+		{"ou pelo dia do mês", "0 9 15 * mon", "2026-03-10 00:00", "2026-03-15 09:00"},
+		{"ou pelo dia da semana", "0 9 15 * mon", "2026-03-15 09:00", "2026-03-16 09:00"},
+		// Campo com * ou cobrindo todo o intervalo não é restrição: valem os dois juntos
+		{"passo com * no dia do mês", "0 0 */2 * mon", "2026-03-10 00:00", "2026-03-23 00:00"},
+		{"dia do mês completo", "0 0 1-31 * mon", "2026-03-10 00:00", "2026-03-16 00:00"},
+		{"dia da semana completo", "0 0 13 * 0-6", "2026-03-10 00:00", "2026-03-13 00:00"},
+		{"dia da semana completo com 7", "0 0 13 * 1-7", "2026-03-10 00:00", "2026-03-13 00:00"},
+
+		// Fim de mês
+		{"pula meses sem dia 31", "0 0 31 * *", "2026-04-01 00:00", "2026-05-31 00:00"},
+		{"virada do ano", "59 23 31 12 *", "2026-12-31 23:59", "2027-12-31 23:59"},
+		{"29 de fevereiro", "0 0 29 2 *", "2026-03-01 00:00", "2028-02-29 00:00"},
+		{"30 de fevereiro", "0 0 30 2 *", "2026-01-01 00:00", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			schedule, err := Parse(tc.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tc.expr, err)
+			}
+			got := schedule.Next(at(tc.from))
+			if tc.want == "" {
+				if !got.IsZero() {
+					t.Fatalf("Next(%s) = %s, esperado nunca", tc.from, got)
+				}
+				return
+			}
+			if want := at(tc.want); !got.Equal(want) {
+				t.Fatalf("Next(%s) = %s, esperado %s", tc.from, got, want)
+			}
+		})
+	}
+}
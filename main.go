@@ -7,6 +7,7 @@ import (
 	"os"
 	"time"
 
+	"backend/config"
 	"backend/controllers"
 	"backend/middleware"
 
@@ -45,14 +46,20 @@ func connectDB() {
 	collection = db.Collection("trips")
 	controllers.Db = db
 	controllers.EnsureAdminExists()
+	controllers.EnsureVerificationIndex()
 
 	fmt.Println("✅ Conectado ao MongoDB com sucesso!")
 }
 
 func main() {
 	connectDB()
+	controllers.RecoverInterruptedJobs()
+	controllers.StartReportScheduler()
+	controllers.StartBackupScheduler()
 
-	app := fiber.New()
+	// Corpo acima do limite padrão (4 MB) não é carregado na memória: fica no socket e
+	// o upload de backup é gravado em arquivo temporário pelo multipart
+	app := fiber.New(fiber.Config{StreamRequestBody: true, DisablePreParseMultipartForm: true})
 
 	frontendURL := os.Getenv("FRONTEND_URL")
 	if frontendURL == "" {
@@ -61,12 +68,17 @@ func main() {
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: frontendURL,
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-Backup-Passphrase",
 		AllowMethods: "GET, POST, PUT, DELETE, PATCH",
 	}))
 
+	// Limite padrão para todas as rotas, inclusive as públicas. Uploads de backup têm
+	// limite próprio, aplicado só depois do login.
+	app.Use(middleware.LimitBody(fiber.DefaultBodyLimit, "/api/restore", "/api/jobs/restore"))
+
 	// Rota Pública
 	app.Post("/api/login", controllers.Login)
+	app.Get("/api/verify/:code", controllers.VerifyTripReceipt) // Conferência do comprovante impresso
 
 	// Rotas Protegidas
 	api := app.Group("/api", middleware.Protected())
@@ -74,6 +86,7 @@ func main() {
 	// --- Viagens ---
 	api.Post("/trips", controllers.CreateTrip)
 	api.Get("/trips", controllers.GetAllTrips)
+	api.Get("/trips/export", controllers.ExportTripsXLSX) // Antes de /trips/:id
 	api.Get("/trips/:id", controllers.GetTripByID)
 	api.Put("/trips/:id", controllers.UpdateTrip)
 
@@ -81,6 +94,10 @@ func main() {
 	api.Patch("/trips/:id/approve", controllers.ApproveTrip)
 	api.Patch("/trips/:id/reopen", controllers.ReopenTrip)
 	api.Delete("/trips/:id", controllers.DeleteTrip)
+	api.Get("/trips/:id/consumption", controllers.GetTripConsumption)
+	api.Get("/trips/:id/pdf", controllers.GetTripPDF)
+	api.Get("/trips/:id/per-diem", controllers.GetTripPerDiem)
+	api.Post("/trips/:id/per-diem/apply", controllers.ApplyTripPerDiem)
 
 	// --- Notificações (NOVO) ---
 	api.Get("/notifications", controllers.CheckNotifications)
@@ -99,10 +116,99 @@ func main() {
 	api.Post("/vehicles", controllers.SaveVehicle)
 	api.Get("/routes", controllers.GetRoutes)
 	api.Post("/routes", controllers.SaveRoute)
+	api.Get("/assistants", controllers.GetAssistants)
+	api.Post("/assistants", controllers.SaveAssistant)
+	api.Get("/assistants/report", controllers.GetAssistantPaymentReport)
+
+	// Importação / Exportação CSV (drivers, vehicles, routes)
+	api.Post("/import/:kind", controllers.ImportCatalogCSV)
+	api.Get("/export/:kind", controllers.ExportCatalogCSV)
+
+	// --- Manutenção de Veículos ---
+	api.Get("/maintenance/plans", controllers.GetMaintenancePlans)
+	api.Post("/maintenance/plans", controllers.SaveMaintenancePlan)
+	api.Delete("/maintenance/plans/:id", controllers.DeleteMaintenancePlan)
+	api.Get("/maintenance/records", controllers.GetMaintenanceRecords)
+	api.Post("/maintenance/records", controllers.SaveMaintenanceRecord)
+	api.Delete("/maintenance/records/:id", controllers.DeleteMaintenanceRecord)
+	api.Get("/maintenance/due", controllers.GetMaintenanceDue)
+
+	// --- Diárias ---
+	api.Get("/per-diem/rules", controllers.GetPerDiemRules)
+	api.Post("/per-diem/rules", controllers.SavePerDiemRule)
+	api.Delete("/per-diem/rules/:id", controllers.DeletePerDiemRule)
+	api.Get("/holidays", controllers.GetHolidays)
+	api.Post("/holidays", controllers.SaveHoliday)
+	api.Delete("/holidays/:id", controllers.DeleteHoliday)
+
+	// --- Combustível ---
+	api.Get("/fuel/vehicles", controllers.GetVehicleConsumption)
+	api.Get("/fuel/anomalies", controllers.GetFuelAnomalies)
+
+	// --- Anomalias ---
+	api.Get("/anomalies", controllers.GetAnomalies)
+	api.Get("/anomalies/distribution", controllers.GetRouteDistribution)
+	api.Post("/anomalies/rescan", controllers.RescanAnomalies)
+	api.Patch("/anomalies/:id/review", controllers.ReviewAnomaly)
+
+	// --- Relatórios ---
+	api.Get("/reports/closing", controllers.GetClosingReport)
+	api.Get("/analytics/profitability", controllers.GetProfitabilityAnalytics)
+
+	// --- Metas de Gasto ---
+	api.Get("/budgets", controllers.GetBudgets)
+	api.Post("/budgets", controllers.SaveBudget)
+	api.Delete("/budgets/:id", controllers.DeleteBudget)
+	api.Get("/budgets/variance", controllers.GetBudgetVariance)
+
+	// --- Relatórios Agendados ---
+	api.Get("/report-schedules", controllers.GetReportSchedules)
+	api.Post("/report-schedules", controllers.SaveReportSchedule)
+	api.Delete("/report-schedules/:id", controllers.DeleteReportSchedule)
+	api.Post("/report-schedules/:id/run", controllers.RunReportScheduleNow)
+	api.Get("/report-runs", controllers.GetReportRuns)
+	api.Get("/report-runs/:id/download", controllers.DownloadReportRun)
+	api.Delete("/report-runs/:id", controllers.DeleteReportRun)
+
+	// --- Extrato e Acertos ---
+	api.Get("/statements", controllers.GetStatement)
+	api.Get("/settlements", controllers.GetSettlements)
+	api.Post("/settlements", controllers.SaveSettlement)
+	api.Delete("/settlements/:id", controllers.DeleteSettlement)
+
+	// --- Contabilidade ---
+	api.Get("/accounting/mappings", controllers.GetAccountMappings)
+	api.Post("/accounting/mappings", controllers.SaveAccountMapping)
+	api.Delete("/accounting/mappings/:id", controllers.DeleteAccountMapping)
+	api.Get("/accounting/layout", controllers.GetJournalLayout)
+	api.Put("/accounting/layout", controllers.SaveJournalLayout)
+	api.Get("/accounting/journal", controllers.PreviewJournal)
+	api.Post("/accounting/journal/export", controllers.ExportJournal)
+	api.Get("/accounting/batches", controllers.GetAccountingBatches)
+	api.Delete("/accounting/batches/:id", controllers.DeleteAccountingBatch)
+
+	// --- Folha de Pagamento (diárias e ajudantes) ---
+	api.Get("/payroll", controllers.PreviewPayroll)
+	api.Post("/payroll/export", controllers.ExportPayroll)
+	api.Get("/payroll/batches", controllers.GetPayrollBatches)
+	api.Get("/payroll/batches/:id/csv", controllers.DownloadPayrollBatch)
+	api.Delete("/payroll/batches/:id", controllers.DeletePayrollBatch)
 
 	// --- Backup ---
 	api.Get("/backup", controllers.DownloadBackup)
-	api.Post("/restore", controllers.RestoreBackup)
+	api.Post("/restore", middleware.LimitBody(config.GetUploadLimit()), controllers.RestoreBackup)
+	api.Get("/restore/snapshot", controllers.GetRestoreSnapshot)
+	api.Post("/restore/rollback", controllers.RollbackRestore)
+	api.Get("/backups", controllers.GetStoredBackups)
+	api.Post("/backups", controllers.CreateStoredBackup)
+	api.Get("/backups/:name", controllers.DownloadStoredBackup)
+	api.Post("/backups/:name/restore", controllers.RestoreStoredBackup)
+
+	// --- Tarefas em segundo plano ---
+	api.Post("/jobs/backup", controllers.CreateBackupJob)
+	api.Post("/jobs/restore", middleware.LimitBody(config.GetUploadLimit()), controllers.CreateRestoreJob)
+	api.Get("/jobs", controllers.GetJobs)
+	api.Get("/jobs/:id", controllers.GetJob)
 
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.SendString("API OEM Sales Rodando 🚀")
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// Limita o tamanho do corpo da requisição.
+// Com StreamRequestBody o Fiber não recusa corpos grandes sozinho: acima do limite do
+// servidor o corpo fica no socket e só é lido pelo handler. Este filtro recusa antes.
+// Rotas em except (upload de backup) ficam de fora e usam o próprio limite, depois da autenticação.
+func LimitBody(max int, except ...string) fiber.Handler {
+	skip := map[string]bool{}
+	for _, path := range except {
+		skip[path] = true
+	}
+
+	return func(c *fiber.Ctx) error {
+		if skip[c.Path()] {
+			return c.Next()
+		}
+
+		length := c.Request().Header.ContentLength()
+		if length == -1 || length > max {
+			// O corpo não lido continua no socket: a conexão não pode ser reaproveitada
+			c.Context().SetConnectionClose()
+		}
+		if length == -1 {
+			// Transfer-Encoding: chunked não informa o tamanho antes da leitura
+			return c.Status(411).JSON(fiber.Map{"error": "Informe o tamanho do corpo (Content-Length)"})
+		}
+		if length > max {
+			return c.Status(413).JSON(fiber.Map{"error": "Requisição muito grande"})
+		}
+		return c.Next()
+	}
+}
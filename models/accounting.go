@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Mapeamento de uma categoria da viagem (despesa ou movimentação de caixa) para o plano de contas
+type AccountMapping struct {
+	ID       primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Category string             `json:"category" bson:"category"` // Ex: expense_fuel, value_withdraw
+
+	DebitAccount  string `json:"debit_account" bson:"debit_account"`
+	CreditAccount string `json:"credit_account" bson:"credit_account"`
+	CostCenter    string `json:"cost_center" bson:"cost_center"` // Vazio = centro de custo da rota
+
+	// Histórico do lançamento. Aceita {route}, {driver}, {vehicle}, {start_date}, {trip_id}
+	History string `json:"history" bson:"history"`
+}
+
+// Layout do arquivo exportado para o ERP da contabilidade
+type JournalLayout struct {
+	Format           string          `json:"format" bson:"format"` // "csv" ou "fixed"
+	Delimiter        string          `json:"delimiter" bson:"delimiter"`
+	DateFormat       string          `json:"date_format" bson:"date_format"`             // Ex: dd/mm/yyyy, yyyymmdd
+	DecimalSeparator string          `json:"decimal_separator" bson:"decimal_separator"` // Vazio = centavos implícitos
+	Header           bool            `json:"header" bson:"header"`
+	Columns          []JournalColumn `json:"columns" bson:"columns"`
+}
+
+// Coluna do layout. Width/Align/Pad só valem para o formato "fixed".
+type JournalColumn struct {
+	Field string `json:"field" bson:"field"` // date, debit, credit, amount, cost_center, history, trip_id, category, batch, route, driver
+	Title string `json:"title" bson:"title"`
+	Width int    `json:"width" bson:"width"`
+	Align string `json:"align" bson:"align"` // "left" ou "right"
+	Pad   string `json:"pad" bson:"pad"`     // Caractere de preenchimento (padrão: espaço)
+}
+
+// Lançamento contábil de partida dobrada
+type JournalLine struct {
+	Date          time.Time `json:"date"`
+	DebitAccount  string    `json:"debit_account"`
+	CreditAccount string    `json:"credit_account"`
+	Amount        float64   `json:"amount"`
+	CostCenter    string    `json:"cost_center"`
+	History       string    `json:"history"`
+	Category      string    `json:"category"`
+	TripID        string    `json:"trip_id"`
+	Route         string    `json:"route"`
+	Driver        string    `json:"driver"`
+	Correction    bool      `json:"correction,omitempty"` // Diferença de viagem reaberta (estorno quando negativa)
+}
+
+// Lote de exportação contábil (as viagens ficam marcadas com o ID do lote)
+type AccountingBatch struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	From      string             `json:"from" bson:"from"`
+	To        string             `json:"to" bson:"to"`
+	TripIDs   []string           `json:"trip_ids" bson:"trip_ids"`
+	Lines     int                `json:"lines" bson:"lines"`
+	Total     float64            `json:"total" bson:"total"`
+	CreatedBy string             `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
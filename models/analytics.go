@@ -0,0 +1,53 @@
+package models
+
+// Indicadores de rentabilidade (receita = valor recebido, custo = despesas da viagem)
+type ProfitMetrics struct {
+	Trips   int     `json:"trips"`
+	Km      float64 `json:"km"`
+	Revenue float64 `json:"revenue"`
+	Cost    float64 `json:"cost"`
+	Margin  float64 `json:"margin"`
+
+	MarginPct    float64 `json:"margin_pct"` // Margem / receita (0.15 = 15%)
+	CostPerKm    float64 `json:"cost_per_km"`
+	RevenuePerKm float64 `json:"revenue_per_km"`
+	MarginPerKm  float64 `json:"margin_per_km"`
+}
+
+type ProfitMonth struct {
+	Month string `json:"month"` // YYYY-MM
+	ProfitMetrics
+}
+
+// Comparação do último mês do período com o mês anterior
+type ProfitComparison struct {
+	Month         string `json:"month"`
+	PreviousMonth string `json:"previous_month"`
+
+	MarginChange       float64  `json:"margin_change"`
+	MarginChangePct    *float64 `json:"margin_change_pct"` // nil quando o mês anterior não tem margem
+	RevenueChange      float64  `json:"revenue_change"`
+	CostChange         float64  `json:"cost_change"`
+	CostPerKmChange    float64  `json:"cost_per_km_change"`
+	RevenuePerKmChange float64  `json:"revenue_per_km_change"`
+}
+
+type ProfitGroup struct {
+	Key  string `json:"key"`
+	Rank int    `json:"rank"` // 1 = maior margem
+	ProfitMetrics
+
+	Months         []ProfitMonth     `json:"months"`
+	MonthOverMonth *ProfitComparison `json:"month_over_month"`
+}
+
+type ProfitabilityReport struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	GroupBy string `json:"group_by"`
+
+	Groups         []ProfitGroup     `json:"groups"`
+	Totals         ProfitMetrics     `json:"totals"`
+	Months         []ProfitMonth     `json:"months"`
+	MonthOverMonth *ProfitComparison `json:"month_over_month"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Distribuição histórica de um campo da viagem em uma rota
+type FieldStats struct {
+	Field      string  `json:"field"`
+	Samples    int     `json:"samples"`
+	Mean       float64 `json:"mean"`
+	StdDev     float64 `json:"std_dev"`
+	Median     float64 `json:"median"`
+	Q1         float64 `json:"q1"`
+	Q3         float64 `json:"q3"`
+	UpperFence float64 `json:"upper_fence"` // Acima deste valor a viagem é sinalizada
+}
+
+// Campo da viagem fora do padrão da rota
+type AnomalyFlag struct {
+	Field      string  `json:"field" bson:"field"`
+	Value      float64 `json:"value" bson:"value"`
+	Median     float64 `json:"median" bson:"median"`
+	UpperFence float64 `json:"upper_fence" bson:"upper_fence"`
+	ZScore     float64 `json:"z_score" bson:"z_score"`
+	Samples    int     `json:"samples" bson:"samples"`
+	Reason     string  `json:"reason" bson:"reason"`
+}
+
+// Revisão do admin sobre as anomalias de uma viagem
+type AnomalyReview struct {
+	ReviewedBy string    `json:"reviewed_by" bson:"reviewed_by"`
+	ReviewedAt time.Time `json:"reviewed_at" bson:"reviewed_at"`
+	Notes      string    `json:"notes" bson:"notes"`
+}
+
+// Viagem sinalizada na fila de revisão
+type AnomalyTrip struct {
+	TripID    string         `json:"trip_id"`
+	Route     string         `json:"route"`
+	Driver    string         `json:"driver"`
+	Vehicle   string         `json:"vehicle"`
+	UserID    string         `json:"user_id"`
+	StartDate string         `json:"start_date"`
+	Approved  bool           `json:"approved"`
+	Flags     []AnomalyFlag  `json:"flags"`
+	Review    *AnomalyReview `json:"review,omitempty"`
+}
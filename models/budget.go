@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Meta de gasto mensal de uma rota ou de um centro de custo
+type Budget struct {
+	ID         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Route      string             `json:"route,omitempty" bson:"route,omitempty"`             // Rota OU centro de custo
+	CostCenter string             `json:"cost_center,omitempty" bson:"cost_center,omitempty"` // (cobre todas as rotas do centro)
+	Month      string             `json:"month" bson:"month"`                                 // YYYY-MM
+	Category   string             `json:"category" bson:"category"`                           // expense_fuel, expense_toll... ou "total"
+	Amount     float64            `json:"amount" bson:"amount"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Orçado x realizado de uma meta
+type BudgetVariance struct {
+	Budget
+	Trips       int     `json:"trips"`
+	Actual      float64 `json:"actual"`
+	Variance    float64 `json:"variance"`     // Realizado - orçado (positivo = acima da meta)
+	VariancePct float64 `json:"variance_pct"` // 0.1 = 10% acima
+
+	// Projeção para o fim do mês mantendo o ritmo atual
+	Forecast            float64 `json:"forecast"`
+	ForecastVariance    float64 `json:"forecast_variance"`
+	ForecastVariancePct float64 `json:"forecast_variance_pct"`
+
+	Status string `json:"status"` // "over" (estourou), "at_risk" (projeção estoura) ou "under"
+}
+
+// Gasto sem meta cadastrada no mês
+type UnbudgetedExpense struct {
+	Route  string  `json:"route"`
+	Trips  int     `json:"trips"`
+	Actual float64 `json:"actual"`
+}
+
+type BudgetReport struct {
+	Month       string              `json:"month"`
+	ElapsedDays int                 `json:"elapsed_days"`
+	MonthDays   int                 `json:"month_days"`
+	Budgets     []BudgetVariance    `json:"budgets"`
+	Unbudgeted  []UnbudgetedExpense `json:"unbudgeted"`
+
+	TotalBudget   float64 `json:"total_budget"`
+	TotalActual   float64 `json:"total_actual"`
+	TotalForecast float64 `json:"total_forecast"`
+}
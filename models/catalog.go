@@ -7,6 +7,8 @@ type Driver struct {
 	Name   string             `json:"name" bson:"name"`
 	Phone  string             `json:"phone" bson:"phone"` // Campo Novo
 	Active bool               `json:"active" bson:"active"`
+
+	Document string `json:"document" bson:"document"` // CPF (exportação da folha)
 }
 
 type Vehicle struct {
@@ -16,6 +18,19 @@ type Vehicle struct {
 }
 
 type Route struct {
-	ID   primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Name string             `json:"name" bson:"name"`
+	ID     primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name   string             `json:"name" bson:"name"`
+	Region string             `json:"region" bson:"region"` // Usado nas regras de diária
+
+	CostCenter string `json:"cost_center" bson:"cost_center"` // Centro de custo contábil
+}
+
+// Ajudante (diária paga por dia trabalhado na viagem)
+type Assistant struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	Document  string             `json:"document" bson:"document"` // CPF
+	Phone     string             `json:"phone" bson:"phone"`
+	DailyRate float64            `json:"daily_rate" bson:"daily_rate"`
+	Active    bool               `json:"active" bson:"active"`
 }
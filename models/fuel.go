@@ -0,0 +1,51 @@
+package models
+
+// Consumo entre dois abastecimentos de tanque cheio
+type TankConsumption struct {
+	FromOdometer float64 `json:"from_odometer"`
+	ToOdometer   float64 `json:"to_odometer"`
+	Date         string  `json:"date"`
+	Km           float64 `json:"km"`
+	Liters       float64 `json:"liters"`
+	KmPerLiter   float64 `json:"km_per_liter"`
+}
+
+// Consumo de uma viagem comparado com o histórico do veículo
+type TripConsumption struct {
+	TripID    string `json:"trip_id"`
+	Vehicle   string `json:"vehicle"`
+	Route     string `json:"route"`
+	StartDate string `json:"start_date"`
+
+	Km         float64 `json:"km"`
+	Liters     float64 `json:"liters"`
+	FuelCost   float64 `json:"fuel_cost"`
+	KmPerLiter float64 `json:"km_per_liter"`
+
+	Tanks []TankConsumption `json:"tanks"`
+
+	// Média do veículo nas outras viagens e desvio relativo (0.25 = 25% acima)
+	VehicleAverage float64 `json:"vehicle_average"`
+	Deviation      float64 `json:"deviation"`
+	Flagged        bool    `json:"flagged"`
+}
+
+// Consumo agregado de um veículo em um mês (YYYY-MM)
+type MonthConsumption struct {
+	Month      string  `json:"month"`
+	Km         float64 `json:"km"`
+	Liters     float64 `json:"liters"`
+	FuelCost   float64 `json:"fuel_cost"`
+	KmPerLiter float64 `json:"km_per_liter"`
+}
+
+type VehicleConsumption struct {
+	Vehicle    string             `json:"vehicle"`
+	Trips      int                `json:"trips"`
+	Km         float64            `json:"km"`
+	Liters     float64            `json:"liters"`
+	FuelCost   float64            `json:"fuel_cost"`
+	KmPerLiter float64            `json:"km_per_liter"`
+	Tanks      []TankConsumption  `json:"tanks"`
+	Months     []MonthConsumption `json:"months"`
+}
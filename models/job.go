@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Andamento de uma tarefa em segundo plano
+type JobProgress struct {
+	Phase       string         `json:"phase" bson:"phase"`                       // backup, staging, merge, swap...
+	Percent     float64        `json:"percent" bson:"percent"`                   // Estimativa de 0 a 100
+	Collections map[string]int `json:"collections" bson:"collections"`           // Documentos processados por coleção
+	Totals      map[string]int `json:"totals,omitempty" bson:"totals,omitempty"` // Total estimado (backup)
+	UpdatedAt   time.Time      `json:"updated_at" bson:"updated_at"`
+}
+
+// Backup ou restauração executado em segundo plano (coleção jobs)
+type Job struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	Type   string             `json:"type" bson:"type"`     // backup ou restore
+	Status string             `json:"status" bson:"status"` // queued, running, success, failed
+
+	Params   map[string]string `json:"params,omitempty" bson:"params,omitempty"` // Opções informadas (nunca a senha)
+	Progress JobProgress       `json:"progress" bson:"progress"`
+	Result   bson.M            `json:"result,omitempty" bson:"result,omitempty"` // Resumo final
+	Error    string            `json:"error,omitempty" bson:"error,omitempty"`
+
+	CreatedBy  string     `json:"created_by" bson:"created_by"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty" bson:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+}
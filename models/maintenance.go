@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Plano de manutenção de um veículo (Ex: Troca de óleo a cada 10.000 km ou 6 meses)
+type MaintenancePlan struct {
+	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	VehicleID   primitive.ObjectID `json:"vehicle_id" bson:"vehicle_id"`
+	Description string             `json:"description" bson:"description"`
+
+	// Zero = critério não utilizado
+	IntervalKm     float64 `json:"interval_km" bson:"interval_km"`
+	IntervalMonths int     `json:"interval_months" bson:"interval_months"`
+
+	// Ponto de partida quando ainda não existe nenhum registro de manutenção
+	StartKm   float64 `json:"start_km" bson:"start_km"`
+	StartDate string  `json:"start_date" bson:"start_date"`
+
+	Active    bool      `json:"active" bson:"active"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Manutenção realizada (oficina, custo, odômetro)
+type MaintenanceRecord struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	VehicleID primitive.ObjectID `json:"vehicle_id" bson:"vehicle_id"`
+	PlanID    primitive.ObjectID `json:"plan_id,omitempty" bson:"plan_id,omitempty"`
+
+	Date     string  `json:"date" bson:"date"`
+	Km       float64 `json:"km" bson:"km"`
+	Cost     float64 `json:"cost" bson:"cost"`
+	Workshop string  `json:"workshop" bson:"workshop"`
+	Notes    string  `json:"notes" bson:"notes"`
+
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Situação calculada de um plano (não é salva no banco)
+type MaintenanceStatus struct {
+	Plan    MaintenancePlan `json:"plan"`
+	Vehicle Vehicle         `json:"vehicle"`
+
+	CurrentKm       float64 `json:"current_km"`
+	LastServiceKm   float64 `json:"last_service_km"`
+	LastServiceDate string  `json:"last_service_date"`
+
+	NextDueKm     float64 `json:"next_due_km,omitempty"`
+	NextDueDate   string  `json:"next_due_date,omitempty"`
+	KmRemaining   float64 `json:"km_remaining"`
+	DaysRemaining int     `json:"days_remaining"`
+
+	// "ok", "due" (vencendo) ou "overdue" (vencida)
+	Status string `json:"status"`
+}
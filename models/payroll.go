@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Valor a pagar a uma pessoa na folha (diárias do motorista ou ajudante)
+type PayrollEntry struct {
+	Kind     string   `json:"kind" bson:"kind"` // "driver" ou "assistant"
+	Name     string   `json:"name" bson:"name"`
+	Document string   `json:"document" bson:"document"`
+	Days     float64  `json:"days" bson:"days"`
+	Amount   float64  `json:"amount" bson:"amount"`
+	Trips    []string `json:"trips" bson:"trips"` // IDs das viagens
+
+	Correction bool `json:"correction,omitempty" bson:"correction,omitempty"` // Diferença de viagens reabertas (pode ser negativa)
+}
+
+// Parte de uma viagem no valor de uma pessoa. Fica gravada na viagem exportada
+// para uma correção posterior pagar só a diferença.
+type PayrollShare struct {
+	Key    string  `json:"key" bson:"key"` // "driver:<nome>", "assistant:<id ou nome>" ou "assistant:?"
+	Kind   string  `json:"kind" bson:"kind"`
+	Name   string  `json:"name" bson:"name"`
+	Days   float64 `json:"days" bson:"days"`
+	Amount float64 `json:"amount" bson:"amount"`
+}
+
+// Lote exportado para o RH (as viagens ficam marcadas com o ID do lote)
+type PayrollBatch struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	From      string             `json:"from" bson:"from"`
+	To        string             `json:"to" bson:"to"`
+	TripIDs   []string           `json:"trip_ids" bson:"trip_ids"`
+	Entries   []PayrollEntry     `json:"entries" bson:"entries"`
+	Total     float64            `json:"total" bson:"total"`
+	CreatedBy string             `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Regra de cálculo de diária.
+// Prioridade: regra da rota > regra da região > regra padrão (rota e região vazias).
+type PerDiemRule struct {
+	ID     primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name   string             `json:"name" bson:"name"`
+	Route  string             `json:"route" bson:"route"`
+	Region string             `json:"region" bson:"region"`
+
+	DailyRate float64 `json:"daily_rate" bson:"daily_rate"`
+
+	// Fração da diária no dia de saída e no de retorno (Ex: 0.5). Zero = diária cheia.
+	DepartureFactor float64 `json:"departure_factor" bson:"departure_factor"`
+	ReturnFactor    float64 `json:"return_factor" bson:"return_factor"`
+
+	// Multiplicadores (Ex: 1.5). Zero = sem acréscimo. Feriado prevalece sobre fim de semana.
+	WeekendMultiplier float64 `json:"weekend_multiplier" bson:"weekend_multiplier"`
+	HolidayMultiplier float64 `json:"holiday_multiplier" bson:"holiday_multiplier"`
+
+	// Tetos por viagem. Zero = sem limite.
+	MaxDays   float64 `json:"max_days" bson:"max_days"`
+	MaxAmount float64 `json:"max_amount" bson:"max_amount"`
+
+	// Preenche ExpenseDaily automaticamente quando a viagem é criada sem valor
+	AutoFill bool `json:"auto_fill" bson:"auto_fill"`
+	Active   bool `json:"active" bson:"active"`
+}
+
+type Holiday struct {
+	ID   primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Date string             `json:"date" bson:"date"` // YYYY-MM-DD
+	Name string             `json:"name" bson:"name"`
+}
+
+// Diária esperada de uma viagem (não é salva no banco)
+type PerDiemCalculation struct {
+	RuleID   string       `json:"rule_id"`
+	RuleName string       `json:"rule_name"`
+	Days     []PerDiemDay `json:"days"`
+
+	TotalDays  float64 `json:"total_days"`
+	Expected   float64 `json:"expected"`
+	Declared   float64 `json:"declared"`
+	Difference float64 `json:"difference"` // Declarado - esperado
+	Capped     bool    `json:"capped"`
+}
+
+type PerDiemDay struct {
+	Date       string  `json:"date"`
+	Factor     float64 `json:"factor"`
+	Multiplier float64 `json:"multiplier"`
+	Amount     float64 `json:"amount"`
+	Note       string  `json:"note,omitempty"`
+}
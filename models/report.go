@@ -0,0 +1,34 @@
+package models
+
+// Subtotal de um agrupamento do fechamento (rota, motorista, veículo ou usuário)
+type ReportTotals struct {
+	Key   string `json:"key" bson:"_id"`
+	Trips int    `json:"trips" bson:"trips"`
+
+	KmDriven      float64 `json:"km_driven" bson:"km_driven"`
+	ValueWithdraw float64 `json:"value_withdraw" bson:"value_withdraw"`
+	ValueReceived float64 `json:"value_received" bson:"value_received"`
+
+	ExpenseFuel      float64 `json:"expense_fuel" bson:"expense_fuel"`
+	ExpenseDaily     float64 `json:"expense_daily" bson:"expense_daily"`
+	ExpenseAssistant float64 `json:"expense_assistant" bson:"expense_assistant"`
+	ExpenseToll      float64 `json:"expense_toll" bson:"expense_toll"`
+	ExpenseOther     float64 `json:"expense_other" bson:"expense_other"`
+	ExpenseTotal     float64 `json:"expense_total" bson:"expense_total"`
+
+	// Retirado + recebido - despesas (valor que o motorista deve devolver)
+	Balance float64 `json:"balance" bson:"balance"`
+}
+
+// Relatório de fechamento de um período
+type ClosingReport struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	ByRoute   []ReportTotals `json:"by_route" bson:"by_route"`
+	ByDriver  []ReportTotals `json:"by_driver" bson:"by_driver"`
+	ByVehicle []ReportTotals `json:"by_vehicle" bson:"by_vehicle"`
+	ByUser    []ReportTotals `json:"by_user" bson:"by_user"`
+
+	Totals ReportTotals `json:"totals" bson:"-"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Filtros de viagem aplicados ao relatório agendado
+type ReportFilters struct {
+	Route   string `json:"route,omitempty" bson:"route,omitempty"`
+	Driver  string `json:"driver,omitempty" bson:"driver,omitempty"`
+	Vehicle string `json:"vehicle,omitempty" bson:"vehicle,omitempty"`
+	User    string `json:"user,omitempty" bson:"user,omitempty"`
+	Status  string `json:"status,omitempty" bson:"status,omitempty"`     // "approved" ou "open"
+	GroupBy string `json:"group_by,omitempty" bson:"group_by,omitempty"` // Só para rentabilidade
+}
+
+// Relatório gerado automaticamente no servidor
+type ReportSchedule struct {
+	ID     primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name   string             `json:"name" bson:"name"`
+	Cron   string             `json:"cron" bson:"cron"`     // Ex: "0 7 * * mon" (segunda às 07:00)
+	Report string             `json:"report" bson:"report"` // closing, trips, profitability, statement
+	Format string             `json:"format" bson:"format"` // json, xlsx, csv, pdf (depende do relatório)
+	Period string             `json:"period" bson:"period"` // yesterday, last_7_days, current_week, last_week, current_month, last_month
+
+	Filters ReportFilters `json:"filters" bson:"filters"`
+	Active  bool          `json:"active" bson:"active"`
+
+	NextRun   *time.Time `json:"next_run,omitempty" bson:"next_run,omitempty"`
+	LastRun   *time.Time `json:"last_run,omitempty" bson:"last_run,omitempty"`
+	CreatedBy string     `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+}
+
+// Histórico de geração (um arquivo por execução)
+type ReportRun struct {
+	ID         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	ScheduleID primitive.ObjectID `json:"schedule_id" bson:"schedule_id"`
+	Name       string             `json:"name" bson:"name"`
+	Report     string             `json:"report" bson:"report"`
+	Format     string             `json:"format" bson:"format"`
+	From       string             `json:"from" bson:"from"`
+	To         string             `json:"to" bson:"to"`
+	Trigger    string             `json:"trigger" bson:"trigger"` // "schedule" ou "manual"
+	Status     string             `json:"status" bson:"status"`   // "success" ou "failed"
+	Error      string             `json:"error,omitempty" bson:"error,omitempty"`
+	File       string             `json:"file,omitempty" bson:"file,omitempty"` // Caminho relativo a REPORTS_DIR
+	Size       int64              `json:"size" bson:"size"`
+	StartedAt  time.Time          `json:"started_at" bson:"started_at"`
+	FinishedAt time.Time          `json:"finished_at" bson:"finished_at"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Acerto de contas com o motorista.
+// Valor positivo = motorista devolveu dinheiro; negativo = empresa pagou o motorista.
+type Settlement struct {
+	ID     primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID string             `json:"user_id" bson:"user_id"`
+	Driver string             `json:"driver" bson:"driver"`
+
+	Date   string  `json:"date" bson:"date"`
+	Amount float64 `json:"amount" bson:"amount"`
+	Method string  `json:"method" bson:"method"` // Ex: Dinheiro, PIX
+	Notes  string  `json:"notes" bson:"notes"`
+
+	CreatedBy string    `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Linha do extrato (viagem ou acerto)
+type StatementEntry struct {
+	Date        string `json:"date"`
+	Type        string `json:"type"` // "trip" ou "settlement"
+	ReferenceID string `json:"reference_id"`
+	Description string `json:"description"`
+
+	Withdrawn float64 `json:"withdrawn"`
+	Received  float64 `json:"received"`
+	Expenses  float64 `json:"expenses"`
+	Settled   float64 `json:"settled"`
+
+	// Efeito no saldo e saldo acumulado (positivo = motorista deve à empresa)
+	Amount  float64 `json:"amount"`
+	Balance float64 `json:"balance"`
+}
+
+type Statement struct {
+	User   string `json:"user,omitempty"`
+	Driver string `json:"driver,omitempty"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+
+	OpeningBalance float64          `json:"opening_balance"`
+	Entries        []StatementEntry `json:"entries"`
+
+	TotalWithdrawn float64 `json:"total_withdrawn"`
+	TotalReceived  float64 `json:"total_received"`
+	TotalExpenses  float64 `json:"total_expenses"`
+	TotalSettled   float64 `json:"total_settled"`
+	ClosingBalance float64 `json:"closing_balance"`
+}
@@ -14,6 +14,34 @@ type Trip struct {
 	// --- NOVO CAMPO: Controle de Notificação ---
 	ApprovalViewed bool `json:"approval_viewed" bson:"approval_viewed"`
 
+	// Quem aprovou e quando (impresso no comprovante)
+	ApprovedBy string     `json:"approved_by,omitempty" bson:"approved_by,omitempty"`
+	ApprovedAt *time.Time `json:"approved_at,omitempty" bson:"approved_at,omitempty"`
+
+	// Código impresso no PDF para conferir a autenticidade do comprovante
+	VerificationCode string `json:"verification_code,omitempty" bson:"verification_code,omitempty"`
+
+	// Lote da exportação contábil (evita enviar a mesma viagem duas vezes)
+	AccountingBatch      string     `json:"accounting_batch,omitempty" bson:"accounting_batch,omitempty"`
+	AccountingExportedAt *time.Time `json:"accounting_exported_at,omitempty" bson:"accounting_exported_at,omitempty"`
+
+	// Valor por categoria já enviado à contabilidade. Reaberta depois da exportação, a viagem
+	// fica marcada como correção e o próximo lote leva só a diferença.
+	AccountingExported   map[string]float64 `json:"accounting_exported,omitempty" bson:"accounting_exported,omitempty"`
+	AccountingCorrection bool               `json:"accounting_correction,omitempty" bson:"accounting_correction,omitempty"`
+
+	// Lote da folha de pagamento (diárias e ajudantes não são pagos duas vezes)
+	PayrollBatch      string     `json:"payroll_batch,omitempty" bson:"payroll_batch,omitempty"`
+	PayrollExportedAt *time.Time `json:"payroll_exported_at,omitempty" bson:"payroll_exported_at,omitempty"`
+
+	// Parte de cada pessoa já enviada à folha (base da correção de viagem reaberta)
+	PayrollExported   []PayrollShare `json:"payroll_exported,omitempty" bson:"payroll_exported,omitempty"`
+	PayrollCorrection bool           `json:"payroll_correction,omitempty" bson:"payroll_correction,omitempty"`
+
+	// Campos fora do padrão da rota (recalculados no lançamento e na aprovação)
+	Anomalies     []AnomalyFlag  `json:"anomalies,omitempty" bson:"anomalies,omitempty"`
+	AnomalyReview *AnomalyReview `json:"anomaly_review,omitempty" bson:"anomaly_review,omitempty"`
+
 	CreatedAt time.Time `json:"created_at" bson:"created_at"`
 
 	Route     string `json:"route" bson:"route"`
@@ -35,4 +63,61 @@ type Trip struct {
 	ExpenseAssistant float64 `json:"expense_assistant" bson:"expense_assistant"`
 	ExpenseToll      float64 `json:"expense_toll" bson:"expense_toll"`
 	ExpenseOther     float64 `json:"expense_other" bson:"expense_other"`
+
+	// Abastecimentos da viagem (quando informados, ExpenseFuel é calculado a partir deles)
+	Refuels []Refuel `json:"refuels" bson:"refuels,omitempty"`
+
+	// Ajudantes da viagem (quando informados, ExpenseAssistant é calculado a partir deles)
+	Assistants []TripAssistant `json:"assistants" bson:"assistants,omitempty"`
+}
+
+type Refuel struct {
+	Date          string  `json:"date" bson:"date"`
+	Liters        float64 `json:"liters" bson:"liters"`
+	PricePerLiter float64 `json:"price_per_liter" bson:"price_per_liter"`
+	Station       string  `json:"station" bson:"station"`
+	Odometer      float64 `json:"odometer" bson:"odometer"`
+	FullTank      bool    `json:"full_tank" bson:"full_tank"`
+}
+
+// Ajudante escalado na viagem. Nome e diária são copiados do cadastro
+// para o valor histórico não mudar quando a diária for reajustada.
+type TripAssistant struct {
+	AssistantID primitive.ObjectID `json:"assistant_id" bson:"assistant_id"`
+	Name        string             `json:"name" bson:"name"`
+	Days        float64            `json:"days" bson:"days"`
+	DailyRate   float64            `json:"daily_rate" bson:"daily_rate"`
+	Amount      float64            `json:"amount" bson:"amount"`
+}
+
+// Km rodados na viagem
+func (t Trip) KmDriven() float64 {
+	if t.KmEnd <= t.KmStart {
+		return 0
+	}
+	return t.KmEnd - t.KmStart
+}
+
+// Soma de todas as despesas da viagem
+func (t Trip) TotalExpenses() float64 {
+	return t.ExpenseFuel + t.ExpenseDaily + t.ExpenseAssistant + t.ExpenseToll + t.ExpenseOther
+}
+
+// Retirado + recebido - despesas (valor que o motorista deve devolver)
+func (t Trip) Balance() float64 {
+	return t.ValueWithdraw + t.ValueReceived - t.TotalExpenses()
+}
+
+// Total de litros abastecidos na viagem
+func (t Trip) FuelLiters() float64 {
+	total := 0.0
+	for _, r := range t.Refuels {
+		total += r.Liters
+	}
+	return total
+}
+
+// Valor pago no abastecimento
+func (r Refuel) Amount() float64 {
+	return r.Liters * r.PricePerLiter
 }
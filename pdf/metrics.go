@@ -0,0 +1,58 @@
+package pdf
+
+import "unicode"
+
+// Larguras (em 1/1000 do tamanho da fonte) dos caracteres ASCII 32..126
+// conforme os arquivos AFM das fontes padrão.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// Letras acentuadas usam a largura da letra base
+var accentBase = map[rune]rune{
+	'á': 'a', 'à': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'é': 'e', 'ê': 'e', 'è': 'e', 'í': 'i', 'ì': 'i',
+	'ó': 'o', 'ô': 'o', 'õ': 'o', 'ò': 'o', 'ú': 'u', 'ü': 'u', 'ç': 'c', 'ñ': 'n',
+	'Á': 'A', 'À': 'A', 'Â': 'A', 'Ã': 'A', 'É': 'E', 'Ê': 'E', 'Í': 'I', 'Ó': 'O', 'Ô': 'O',
+	'Õ': 'O', 'Ú': 'U', 'Ç': 'C', 'Ñ': 'N',
+}
+
+// Largura do texto em pontos
+func TextWidth(text string, size float64, font Font) float64 {
+	total := 0
+	for _, r := range text {
+		if font == Mono {
+			total += 600
+			continue
+		}
+		if base, ok := accentBase[r]; ok {
+			r = base
+		}
+		widths := &helveticaWidths
+		if font == Bold {
+			widths = &helveticaBoldWidths
+		}
+		switch {
+		case r >= 32 && r <= 126:
+			total += widths[r-32]
+		case unicode.IsUpper(r):
+			total += 722
+		default:
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
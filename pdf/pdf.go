@@ -0,0 +1,188 @@
+// Gerador mínimo de PDF (A4, fontes padrão Helvetica/Courier, texto e linhas).
+// Suficiente para os comprovantes do sistema, sem depender de biblioteca externa.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Tamanho A4 em pontos
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+type Font int
+
+const (
+	Regular Font = iota
+	Bold
+	Mono
+)
+
+// Nome da fonte no dicionário de recursos da página
+var fontResources = []string{"F1", "F2", "F3"}
+var fontNames = []string{"Helvetica", "Helvetica-Bold", "Courier"}
+
+type Document struct {
+	Title string
+	pages []*Page
+}
+
+// Página com origem no canto SUPERIOR esquerdo (y cresce para baixo)
+type Page struct {
+	content bytes.Buffer
+}
+
+func New(title string) *Document {
+	return &Document{Title: title}
+}
+
+func (d *Document) AddPage() *Page {
+	p := &Page{}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Escreve um texto com a base em (x, y)
+func (p *Page) Text(x, y, size float64, font Font, text string) {
+	fmt.Fprintf(&p.content, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n",
+		fontResources[font], size, x, PageHeight-y, escape(encodeWinAnsi(text)))
+}
+
+// Escreve um texto alinhado à direita terminando em x
+func (p *Page) TextRight(x, y, size float64, font Font, text string) {
+	p.Text(x-TextWidth(text, size, font), y, size, font, text)
+}
+
+// Escreve um texto centralizado em x
+func (p *Page) TextCenter(x, y, size float64, font Font, text string) {
+	p.Text(x-TextWidth(text, size, font)/2, y, size, font, text)
+}
+
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, PageHeight-y1, x2, PageHeight-y2)
+}
+
+// Retângulo com o canto superior esquerdo em (x, y)
+func (p *Page) Rect(x, y, w, h, width float64) {
+	fmt.Fprintf(&p.content, "%.2f w %.2f %.2f %.2f %.2f re S\n", width, x, PageHeight-y-h, w, h)
+}
+
+// Quebra o texto em linhas que caibam na largura informada
+func WrapText(text string, width, size float64, font Font) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		words := strings.Fields(paragraph)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		line := words[0]
+		for _, word := range words[1:] {
+			if TextWidth(line+" "+word, size, font) > width {
+				lines = append(lines, line)
+				line = word
+				continue
+			}
+			line += " " + word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Gera o arquivo PDF
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	var offsets []int
+
+	startObj := func() int {
+		offsets = append(offsets, buf.Len())
+		return len(offsets)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1: Catálogo, 2: Árvore de páginas, 3..5: Fontes, 6: Info
+	pagesObj := 2
+	startObj()
+	fmt.Fprintf(&buf, "1 0 obj\n<< /Type /Catalog /Pages %d 0 R >>\nendobj\n", pagesObj)
+
+	firstPageObj := 7
+	var kids []string
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", firstPageObj+i*2))
+	}
+	startObj()
+	fmt.Fprintf(&buf, "2 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(d.pages))
+
+	for i, name := range fontNames {
+		n := startObj()
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /Font /Subtype /Type1 /Name /%s /BaseFont /%s /Encoding /WinAnsiEncoding >>\nendobj\n", n, fontResources[i], name)
+	}
+
+	startObj()
+	fmt.Fprintf(&buf, "6 0 obj\n<< /Title (%s) /Producer (OEM Fechamento) >>\nendobj\n", escape(encodeWinAnsi(d.Title)))
+
+	fonts := ""
+	for i, res := range fontResources {
+		fonts += fmt.Sprintf("/%s %d 0 R ", res, 3+i)
+	}
+
+	for _, page := range d.pages {
+		pageObj := startObj()
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << %s>> >> /Contents %d 0 R >>\nendobj\n",
+			pageObj, pagesObj, PageWidth, PageHeight, fonts, pageObj+1)
+
+		contentObj := startObj()
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Length %d >>\nstream\n", contentObj, page.content.Len())
+		buf.Write(page.content.Bytes())
+		buf.WriteString("endstream\nendobj\n")
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 6 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	d.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", "", "\n", " ").Replace(s)
+}
+
+// Caracteres fora do Latin-1 que existem no Windows-1252
+var winAnsiExtras = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '•': 0x95, '–': 0x96, '—': 0x97,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, 'ª': 0xAA, 'º': 0xBA,
+}
+
+// Converte UTF-8 para WinAnsiEncoding (acentos do português incluídos)
+func encodeWinAnsi(s string) string {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			out = append(out, byte(r))
+		case winAnsiExtras[r] != 0:
+			out = append(out, winAnsiExtras[r])
+		default:
+			out = append(out, '?')
+		}
+	}
+	return string(out)
+}
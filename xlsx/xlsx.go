@@ -0,0 +1,274 @@
+// Gerador mínimo de planilhas .xlsx (SpreadsheetML) gravando direto no io.Writer.
+// As linhas são escritas à medida que chegam, sem montar a planilha inteira em memória.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Estilos definidos em styles.xml (índice do cellXfs)
+type Style int
+
+const (
+	StyleDefault Style = iota
+	StyleHeader
+	StyleCurrency
+	StyleDate
+	StyleDecimal
+	StyleCurrencyBold
+	StyleDecimalBold
+	StyleInteger
+	StyleBold
+)
+
+type Cell struct {
+	kind    byte // 's' texto, 'n' número, 'e' vazia
+	text    string
+	number  float64
+	formula string
+	style   Style
+}
+
+func String(value string) Cell { return Cell{kind: 's', text: value} }
+func Bold(value string) Cell   { return Cell{kind: 's', text: value, style: StyleBold} }
+func Empty() Cell              { return Cell{kind: 'e'} }
+
+func Number(value float64) Cell   { return Cell{kind: 'n', number: value, style: StyleDecimal} }
+func Integer(value float64) Cell  { return Cell{kind: 'n', number: value, style: StyleInteger} }
+func Currency(value float64) Cell { return Cell{kind: 'n', number: value, style: StyleCurrency} }
+
+// Data como número serial do Excel (dias desde 30/12/1899)
+func Date(value time.Time) Cell {
+	if value.IsZero() {
+		return Empty()
+	}
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	local := time.Date(value.Year(), value.Month(), value.Day(), value.Hour(), value.Minute(), value.Second(), 0, time.UTC)
+	return Cell{kind: 'n', number: local.Sub(base).Hours() / 24, style: StyleDate}
+}
+
+// Fórmula com o valor já calculado (exibido mesmo sem recálculo)
+func Formula(formula string, cached float64, style Style) Cell {
+	return Cell{kind: 'n', number: cached, formula: formula, style: style}
+}
+
+func (c Cell) WithStyle(style Style) Cell {
+	c.style = style
+	return c
+}
+
+type Writer struct {
+	zip    *zip.Writer
+	sheets []string
+	active *Sheet
+}
+
+type Sheet struct {
+	w    *bufio.Writer
+	rows int
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{zip: zip.NewWriter(w)}
+}
+
+// Inicia uma nova aba. A anterior é finalizada (as abas são gravadas em sequência).
+// widths define a largura de cada coluna (em caracteres).
+func (wb *Writer) AddSheet(name string, widths []float64) (*Sheet, error) {
+	if err := wb.closeSheet(); err != nil {
+		return nil, err
+	}
+
+	wb.sheets = append(wb.sheets, name)
+	entry, err := wb.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(wb.sheets)))
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := &Sheet{w: bufio.NewWriter(entry)}
+	sheet.w.WriteString(xmlHeader)
+	sheet.w.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	sheet.w.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(widths) > 0 {
+		sheet.w.WriteString("<cols>")
+		for i, width := range widths {
+			fmt.Fprintf(sheet.w, `<col min="%d" max="%d" width="%.1f" customWidth="1"/>`, i+1, i+1, width)
+		}
+		sheet.w.WriteString("</cols>")
+	}
+	sheet.w.WriteString("<sheetData>")
+
+	wb.active = sheet
+	return sheet, nil
+}
+
+// Número da próxima linha (1 = cabeçalho)
+func (s *Sheet) NextRow() int {
+	return s.rows + 1
+}
+
+func (s *Sheet) WriteRow(cells ...Cell) error {
+	s.rows++
+	fmt.Fprintf(s.w, `<row r="%d">`, s.rows)
+	for i, cell := range cells {
+		ref := ColumnName(i) + strconv.Itoa(s.rows)
+		switch cell.kind {
+		case 'e':
+			continue
+		case 's':
+			fmt.Fprintf(s.w, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, cell.style, escape(cell.text))
+		default:
+			number := cell.number
+			if math.IsNaN(number) || math.IsInf(number, 0) {
+				number = 0
+			}
+			fmt.Fprintf(s.w, `<c r="%s" s="%d">`, ref, cell.style)
+			if cell.formula != "" {
+				fmt.Fprintf(s.w, "<f>%s</f>", escape(cell.formula))
+			}
+			fmt.Fprintf(s.w, "<v>%s</v></c>", strconv.FormatFloat(number, 'f', -1, 64))
+		}
+	}
+	_, err := s.w.WriteString("</row>")
+	return err
+}
+
+// Cabeçalho em negrito
+func (s *Sheet) WriteHeader(titles ...string) error {
+	cells := make([]Cell, len(titles))
+	for i, title := range titles {
+		cells[i] = String(title).WithStyle(StyleHeader)
+	}
+	return s.WriteRow(cells...)
+}
+
+func (wb *Writer) closeSheet() error {
+	if wb.active == nil {
+		return nil
+	}
+	wb.active.w.WriteString("</sheetData></worksheet>")
+	err := wb.active.w.Flush()
+	wb.active = nil
+	return err
+}
+
+// Finaliza a planilha (workbook, estilos e relacionamentos)
+func (wb *Writer) Close() error {
+	if err := wb.closeSheet(); err != nil {
+		return err
+	}
+	if len(wb.sheets) == 0 {
+		return errors.New("xlsx: planilha sem abas")
+	}
+
+	var contentTypes, workbook, workbookRels strings.Builder
+	contentTypes.WriteString(xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(xmlHeader + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	workbookRels.WriteString(xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+
+	for i, name := range wb.sheets {
+		n := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(sheetName(name)), n, n)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(wb.sheets)+1)
+
+	contentTypes.WriteString("</Types>")
+	workbook.WriteString("</sheets></workbook>")
+	workbookRels.WriteString("</Relationships>")
+
+	files := []struct{ name, body string }{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.String()},
+		{"xl/styles.xml", stylesXML},
+	}
+	for _, f := range files {
+		entry, err := wb.zip.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(entry, f.body); err != nil {
+			return err
+		}
+	}
+	return wb.zip.Close()
+}
+
+// Letra da coluna a partir do índice (0 = A, 26 = AA)
+func ColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// O Excel limita o nome da aba a 31 caracteres e proíbe alguns símbolos
+func sheetName(name string) string {
+	name = strings.NewReplacer("/", "-", `\`, "-", "?", "", "*", "", "[", "(", "]", ")", ":", "-").Replace(name)
+	if len([]rune(name)) > 31 {
+		name = string([]rune(name)[:31])
+	}
+	return name
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '"':
+			b.WriteString("&quot;")
+		case r < 0x20 && r != '\t' && r != '\n' && r != '\r':
+			// Caracteres de controle são inválidos em XML
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+// Ordem dos cellXfs segue as constantes Style
+const stylesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="&quot;R$&quot;\ #,##0.00;[Red]\-&quot;R$&quot;\ #,##0.00"/><numFmt numFmtId="165" formatCode="dd/mm/yyyy"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill><fill><patternFill patternType="solid"><fgColor rgb="FFD9E1F2"/><bgColor indexed="64"/></patternFill></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="9">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="1" fillId="0" borderId="0" xfId="0" applyNumberFormat="1" applyFont="1"/>
+<xf numFmtId="4" fontId="1" fillId="0" borderId="0" xfId="0" applyNumberFormat="1" applyFont="1"/>
+<xf numFmtId="3" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+</cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`